@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	trustedProxies, err := parseTrustedProxies("10.0.0.0/8, 192.168.1.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		want         string
+	}{
+		{
+			name:       "direct client",
+			remoteAddr: "203.0.113.7:5123",
+			want:       "203.0.113.7",
+		},
+		{
+			name:         "header from untrusted client is ignored",
+			remoteAddr:   "203.0.113.7:5123",
+			forwardedFor: []string{"198.51.100.1"},
+			want:         "203.0.113.7",
+		},
+		{
+			name:         "behind trusted proxy",
+			remoteAddr:   "10.1.2.3:443",
+			forwardedFor: []string{"198.51.100.1"},
+			want:         "198.51.100.1",
+		},
+		{
+			name:         "spoofed hops before the proxy are skipped",
+			remoteAddr:   "10.1.2.3:443",
+			forwardedFor: []string{"1.2.3.4, 198.51.100.1"},
+			want:         "198.51.100.1",
+		},
+		{
+			name:         "chain of trusted proxies",
+			remoteAddr:   "10.1.2.3:443",
+			forwardedFor: []string{"198.51.100.1, 192.168.1.1", "10.9.9.9"},
+			want:         "198.51.100.1",
+		},
+		{
+			name:         "malformed hop stops the walk",
+			remoteAddr:   "10.1.2.3:443",
+			forwardedFor: []string{"198.51.100.1, nonsense"},
+			want:         "10.1.2.3",
+		},
+		{
+			name:       "trusted proxy without header",
+			remoteAddr: "10.1.2.3:443",
+			want:       "10.1.2.3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwardedFor {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+
+			if got := clientIP(r, trustedProxies); got != tt.want {
+				t.Errorf("clientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxiesInvalid(t *testing.T) {
+	if _, err := parseTrustedProxies("10.0.0.0/8,not-an-ip"); err == nil {
+		t.Error("parseTrustedProxies() accepted an invalid entry")
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/hoang-cao-long/golang-side-projects/rss-services/internal/database"
+)
+
+// newQueries wraps db so every query gets a span and is logged at debug
+// level with the request ID and log attributes of its context. Use it
+// instead of database.New and Queries.WithTx.
+func newQueries(db database.DBTX) *database.Queries {
+	return database.New(tracedDB{db: loggedDB{db: db}})
+}
+
+type loggedDB struct {
+	db database.DBTX
+}
+
+func (l loggedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	start := time.Now()
+	result, err := l.db.ExecContext(ctx, query, args...)
+	logQuery(ctx, query, start, err)
+	return result, err
+}
+
+func (l loggedDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	start := time.Now()
+	stmt, err := l.db.PrepareContext(ctx, query)
+	logQuery(ctx, query, start, err)
+	return stmt, err
+}
+
+func (l loggedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	start := time.Now()
+	rows, err := l.db.QueryContext(ctx, query, args...)
+	logQuery(ctx, query, start, err)
+	return rows, err
+}
+
+// QueryRowContext can't see the error, it only surfaces on Scan
+func (l loggedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	start := time.Now()
+	row := l.db.QueryRowContext(ctx, query, args...)
+	logQuery(ctx, query, start, nil)
+	return row
+}
+
+func logQuery(ctx context.Context, query string, start time.Time, err error) {
+	if !slog.Default().Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String("query", queryName(query)),
+		slog.Int64("duration_ms", time.Since(start).Milliseconds()),
+	}
+
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+
+	slog.LogAttrs(ctx, slog.LevelDebug, "db query", attrs...)
+}
+
+// queryName reads the name sqlc puts on the first line of every query,
+// "-- name: GetFeeds :many"
+func queryName(query string) string {
+	firstLine, _, _ := strings.Cut(query, "\n")
+
+	name, ok := strings.CutPrefix(firstLine, "-- name: ")
+	if !ok {
+		return "unknown"
+	}
+
+	name, _, _ = strings.Cut(name, " ")
+	return name
+}
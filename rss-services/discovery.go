@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	// Pages larger than this are not searched for feed links
+	maxDiscoveryPageSize = 2 << 20
+	// Feed links of a page beyond this many are ignored
+	maxDiscoveryCandidates = 10
+	// Candidates fetched at the same time
+	maxDiscoveryConcurrency = 4
+)
+
+// Paths probed when a page doesn't advertise any feed
+var wellKnownFeedPaths = []string{
+	"/feed",
+	"/rss",
+	"/feed.xml",
+	"/rss.xml",
+	"/atom.xml",
+	"/index.xml",
+}
+
+// MIME types of <link rel="alternate"> tags pointing at a feed
+var feedLinkTypes = map[string]bool{
+	"application/rss+xml":  true,
+	"application/atom+xml": true,
+	"application/rdf+xml":  true,
+	"application/xml":      true,
+	"text/xml":             true,
+}
+
+type FeedCandidate struct {
+	Title  string     `json:"title"`
+	URL    string     `json:"url"`
+	Format FeedFormat `json:"format"`
+}
+
+// discoverFeeds finds the feeds of a website. The page itself is returned
+// when it already is a feed, otherwise the feeds it links to are checked,
+// and only when there are none the well-known feed paths of the site.
+// Every candidate is fetched and parsed, so all returned feeds are valid.
+func discoverFeeds(ctx context.Context, pageURL string) ([]FeedCandidate, error) {
+	dat, finalURL, err := fetchPage(ctx, pageURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if parsedFeed, err := parseFeed(dat); err == nil {
+		return []FeedCandidate{{
+			Title:  parsedFeed.Title,
+			URL:    finalURL.String(),
+			Format: parsedFeed.Format,
+		}}, nil
+	}
+
+	candidates := validateFeedCandidates(ctx, findFeedLinks(dat, finalURL))
+	if len(candidates) > 0 {
+		return candidates, nil
+	}
+
+	wellKnown := []string{}
+	for _, path := range wellKnownFeedPaths {
+		wellKnown = append(wellKnown, finalURL.ResolveReference(&url.URL{Path: path}).String())
+	}
+
+	return validateFeedCandidates(ctx, wellKnown), nil
+}
+
+// fetchPage returns the body of a page along with its URL after redirects
+func fetchPage(ctx context.Context, pageURL string) ([]byte, *url.URL, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resp, err := feedHTTPClient.Do(req)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, nil, fmt.Errorf("unexpected status code %v", resp.StatusCode)
+	}
+
+	dat, err := io.ReadAll(io.LimitReader(resp.Body, maxDiscoveryPageSize))
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return dat, resp.Request.URL, nil
+}
+
+// findFeedLinks returns the absolute URLs of the feed <link> tags of an
+// HTML page, honouring <base href>
+func findFeedLinks(dat []byte, pageURL *url.URL) []string {
+	tokenizer := html.NewTokenizer(bytes.NewReader(dat))
+	base := pageURL
+	links := []string{}
+
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			return links
+		}
+
+		if tokenType != html.StartTagToken && tokenType != html.SelfClosingTagToken {
+			continue
+		}
+
+		token := tokenizer.Token()
+
+		switch token.Data {
+		case "base":
+			if href, err := url.Parse(htmlAttr(token, "href")); err == nil && href.String() != "" {
+				base = pageURL.ResolveReference(href)
+			}
+		case "link":
+			if !hasRel(htmlAttr(token, "rel"), "alternate") {
+				continue
+			}
+
+			mimeType, _, _ := strings.Cut(strings.ToLower(htmlAttr(token, "type")), ";")
+			if !feedLinkTypes[strings.TrimSpace(mimeType)] {
+				continue
+			}
+
+			href, err := url.Parse(strings.TrimSpace(htmlAttr(token, "href")))
+			if err != nil || href.String() == "" {
+				continue
+			}
+
+			links = append(links, base.ResolveReference(href).String())
+		case "body":
+			// Feed links belong in <head>
+			return links
+		}
+	}
+}
+
+// validateFeedCandidates fetches the first maxDiscoveryCandidates distinct
+// URLs, a few at a time, and keeps the ones that parse as a feed in their
+// original order
+func validateFeedCandidates(ctx context.Context, urls []string) []FeedCandidate {
+	unique := []string{}
+	seen := map[string]bool{}
+
+	for _, feedURL := range urls {
+		if seen[feedURL] {
+			continue
+		}
+		seen[feedURL] = true
+
+		unique = append(unique, feedURL)
+		if len(unique) == maxDiscoveryCandidates {
+			break
+		}
+	}
+
+	results := make([]*FeedCandidate, len(unique))
+	slots := make(chan struct{}, maxDiscoveryConcurrency)
+	wg := &sync.WaitGroup{}
+
+	for i, feedURL := range unique {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			fetch, err := urlToFeed(ctx, feedURL, "", "")
+			if err != nil {
+				return
+			}
+
+			results[i] = &FeedCandidate{
+				Title:  fetch.Feed.Title,
+				URL:    feedURL,
+				Format: fetch.Feed.Format,
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	candidates := []FeedCandidate{}
+	for _, candidate := range results {
+		if candidate != nil {
+			candidates = append(candidates, *candidate)
+		}
+	}
+
+	return candidates
+}
+
+func htmlAttr(token html.Token, name string) string {
+	for _, attr := range token.Attr {
+		if attr.Key == name {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+// hasRel reports whether a space separated rel attribute contains value
+func hasRel(rel, value string) bool {
+	for _, field := range strings.Fields(strings.ToLower(rel)) {
+		if field == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Machine readable error codes, part of the API and safe to switch on
+const (
+	errCodeBadRequest    = "bad_request"
+	errCodeUnauthorized  = "unauthorized"
+	errCodeForbidden     = "forbidden"
+	errCodeNotFound      = "not_found"
+	errCodeConflict      = "conflict"
+	errCodeUnprocessable = "unprocessable"
+	errCodeTooLarge      = "payload_too_large"
+	errCodeRateLimited   = "rate_limited"
+	errCodeValidation    = "validation_failed"
+	errCodeInternal      = "internal"
+)
+
+// FieldError describes why a single request field was rejected
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// appError is an error a handler can respond with. Message and Fields are
+// sent to the client, Err is the underlying cause and is only logged.
+type appError struct {
+	Status  int
+	Code    string
+	Message string
+	Fields  []FieldError
+	Err     error
+}
+
+func (e *appError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *appError) Unwrap() error {
+	return e.Err
+}
+
+func errBadRequest(message string) *appError {
+	return &appError{Status: http.StatusBadRequest, Code: errCodeBadRequest, Message: message}
+}
+
+func errUnauthorized(message string) *appError {
+	return &appError{Status: http.StatusUnauthorized, Code: errCodeUnauthorized, Message: message}
+}
+
+func errForbidden(message string) *appError {
+	return &appError{Status: http.StatusForbidden, Code: errCodeForbidden, Message: message}
+}
+
+func errNotFound(message string) *appError {
+	return &appError{Status: http.StatusNotFound, Code: errCodeNotFound, Message: message}
+}
+
+func errConflict(message string) *appError {
+	return &appError{Status: http.StatusConflict, Code: errCodeConflict, Message: message}
+}
+
+func errUnprocessable(message string) *appError {
+	return &appError{Status: http.StatusUnprocessableEntity, Code: errCodeUnprocessable, Message: message}
+}
+
+func errPayloadTooLarge(message string) *appError {
+	return &appError{Status: http.StatusRequestEntityTooLarge, Code: errCodeTooLarge, Message: message}
+}
+
+func errTooManyRequests(message string) *appError {
+	return &appError{Status: http.StatusTooManyRequests, Code: errCodeRateLimited, Message: message}
+}
+
+func errValidation(fields []FieldError) *appError {
+	return &appError{
+		Status:  http.StatusUnprocessableEntity,
+		Code:    errCodeValidation,
+		Message: "Request validation failed",
+		Fields:  fields,
+	}
+}
+
+func errInternal(err error) *appError {
+	return &appError{
+		Status:  http.StatusInternalServerError,
+		Code:    errCodeInternal,
+		Message: "Internal server error",
+		Err:     err,
+	}
+}
+
+// dbError maps an error from a query to an appError. resource names what
+// was queried, e.g. "Feed", and is used in not found and conflict messages.
+// Anything unexpected becomes a 500 so driver messages never reach clients.
+func dbError(err error, resource string) *appError {
+	if errors.Is(err, sql.ErrNoRows) {
+		return errNotFound(fmt.Sprintf("%s not found", resource))
+	}
+
+	pqErr := &pq.Error{}
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code.Name() {
+		case "unique_violation":
+			return errConflict(fmt.Sprintf("%s already exists", resource))
+		case "foreign_key_violation":
+			return errUnprocessable(fmt.Sprintf("%s references a resource that doesn't exist", resource))
+		case "check_violation", "not_null_violation", "invalid_text_representation", "string_data_right_truncation":
+			return errUnprocessable(fmt.Sprintf("Invalid value for %s", resource))
+		}
+	}
+
+	return errInternal(fmt.Errorf("%s: %w", resource, err))
+}
+
+// ownershipError maps an error from a query scoped to the user like
+// dbError, except that when no row was found and exists reports the row
+// with that id is there, it belongs to another user and 403 is returned
+func ownershipError(ctx context.Context, err error, resource string, id uuid.UUID, exists func(context.Context, uuid.UUID) (bool, error)) *appError {
+	if !errors.Is(err, sql.ErrNoRows) {
+		return dbError(err, resource)
+	}
+
+	found, existsErr := exists(ctx, id)
+	if existsErr != nil {
+		return dbError(existsErr, resource)
+	}
+
+	if found {
+		return errForbidden(fmt.Sprintf("%s belongs to another user", resource))
+	}
+
+	return errNotFound(fmt.Sprintf("%s not found", resource))
+}
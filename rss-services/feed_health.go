@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/hoang-cao-long/golang-side-projects/rss-services/internal/database"
+)
+
+const (
+	// A feed failing this many fetches in a row is deactivated
+	maxConsecutiveFailures = 10
+
+	maxFailureBackoff = 24 * time.Hour
+)
+
+// failureBackoff doubles the wait after every consecutive failure,
+// starting from the minimum fetch interval
+func failureBackoff(consecutiveFailures int32) time.Duration {
+	backoff := minFetchInterval
+
+	for i := int32(1); i < consecutiveFailures && backoff < maxFailureBackoff; i++ {
+		backoff *= 2
+	}
+
+	return min(backoff, maxFailureBackoff)
+}
+
+func recordFeedFailure(ctx context.Context, db *database.Queries, feed database.Feed, fetchErr error) {
+	updatedFeed, err := db.RecordFeedFailure(ctx, database.RecordFeedFailureParams{
+		LastError:   sql.NullString{String: fetchErr.Error(), Valid: true},
+		MaxFailures: maxConsecutiveFailures,
+		ID:          feed.ID,
+	})
+
+	if err != nil {
+		slog.ErrorContext(ctx, "Error recording feed failure", "error", err)
+		return
+	}
+
+	if !updatedFeed.Active {
+		slog.WarnContext(ctx, "Feed deactivated", "consecutive_failures", updatedFeed.ConsecutiveFailures)
+		return
+	}
+
+	backoff := failureBackoff(updatedFeed.ConsecutiveFailures)
+
+	err = db.ScheduleFeedFetch(ctx, database.ScheduleFeedFetchParams{
+		IntervalSeconds: int32(backoff / time.Second),
+		ID:              feed.ID,
+	})
+
+	if err != nil {
+		slog.ErrorContext(ctx, "Error scheduling retry of feed", "error", err)
+	}
+}
+
+func recordFeedSuccess(ctx context.Context, db *database.Queries, feed database.Feed) {
+	err := db.RecordFeedSuccess(ctx, feed.ID)
+
+	if err != nil {
+		slog.ErrorContext(ctx, "Error recording feed success", "error", err)
+		return
+	}
+
+	if feed.ConsecutiveFailures > 0 {
+		slog.InfoContext(ctx, "Feed recovered", "consecutive_failures", feed.ConsecutiveFailures)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// Query parameters added by newsletters and analytics that never change
+// what a feed returns
+var trackingParams = map[string]bool{
+	"fbclid":  true,
+	"gclid":   true,
+	"mc_cid":  true,
+	"mc_eid":  true,
+	"_hsenc":  true,
+	"_hsmi":   true,
+	"mkt_tok": true,
+}
+
+// normalizeFeedURL turns the different spellings of a feed URL into one,
+// so the same feed isn't stored twice. It defaults the scheme to https,
+// lowercases the scheme and host, drops default ports, fragments,
+// tracking parameters and a trailing slash, and sorts the query.
+func normalizeFeedURL(rawURL string) (string, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	if rawURL == "" {
+		return "", errors.New("url is required")
+	}
+
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "https://" + rawURL
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", errors.New("url must use http or https")
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if host == "" {
+		return "", errors.New("url must have a host")
+	}
+
+	port := u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+
+	if port != "" {
+		u.Host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		// IPv6 literal
+		u.Host = "[" + host + "]"
+	} else {
+		u.Host = host
+	}
+
+	u.Fragment = ""
+	u.RawFragment = ""
+
+	// Trimmed on the escaped path, decoding it would turn %2F into a slash
+	// and point at another resource
+	escapedPath := strings.TrimRight(u.EscapedPath(), "/")
+	u.Path, err = url.PathUnescape(escapedPath)
+	if err != nil {
+		return "", err
+	}
+	u.RawPath = escapedPath
+
+	query := u.Query()
+	for name := range query {
+		if trackingParams[strings.ToLower(name)] || strings.HasPrefix(strings.ToLower(name), "utm_") {
+			query.Del(name)
+		}
+	}
+	// Encode sorts by key
+	u.RawQuery = query.Encode()
+	u.ForceQuery = false
+
+	return u.String(), nil
+}
+
+// alternateSchemeURL returns a normalized URL with http swapped for https
+// and the other way around, many sites serve the same feed on both
+func alternateSchemeURL(normalizedURL string) string {
+	if rest, ok := strings.CutPrefix(normalizedURL, "https://"); ok {
+		return "http://" + rest
+	}
+	if rest, ok := strings.CutPrefix(normalizedURL, "http://"); ok {
+		return "https://" + rest
+	}
+	return normalizedURL
+}
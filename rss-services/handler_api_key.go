@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/google/uuid"
+	"github.com/hoang-cao-long/golang-side-projects/rss-services/internal/auth"
+	"github.com/hoang-cao-long/golang-side-projects/rss-services/internal/database"
+)
+
+// handleCreateAPIKey mints a new key. The key itself is only part of this
+// response, afterwards only its prefix is known.
+func (apiConfig *apiConfig) handleCreateAPIKey(w http.ResponseWriter, r *http.Request, user database.User) {
+	type parameters struct {
+		Name      string     `json:"name" validate:"required,max=100"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+
+	params := parameters{}
+
+	err := decodeJSONBody(w, r, &params)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	expiresAt := sql.NullTime{}
+	if params.ExpiresAt != nil {
+		if !params.ExpiresAt.After(time.Now()) {
+			respondWithError(w, r, errValidation([]FieldError{{Field: "expires_at", Message: "must be in the future"}}))
+			return
+		}
+		expiresAt = sql.NullTime{Time: params.ExpiresAt.UTC(), Valid: true}
+	}
+
+	apiKey, key, err := createAPIKey(r.Context(), apiConfig.DB, user.ID, strings.TrimSpace(params.Name), expiresAt)
+
+	if err != nil {
+		respondWithError(w, r, dbError(err, "API key"))
+		return
+	}
+
+	respondWithJSON(w, 201, CreatedAPIKey{
+		APIKey: databaseAPIKeyToAPIKey(apiKey),
+		Key:    key,
+	})
+}
+
+func (apiConfig *apiConfig) handleGetAPIKeys(w http.ResponseWriter, r *http.Request, user database.User) {
+	apiKeys, err := apiConfig.DB.GetAPIKeysForUser(r.Context(), user.ID)
+
+	if err != nil {
+		respondWithError(w, r, dbError(err, "API keys"))
+		return
+	}
+
+	respondWithJSON(w, 200, databaseAPIKeysToAPIKeys(apiKeys))
+}
+
+func (apiConfig *apiConfig) handleDeleteAPIKey(w http.ResponseWriter, r *http.Request, user database.User) {
+	apiKeyIDStr := chi.URLParam(r, "apiKeyID")
+	apiKeyID, err := uuid.Parse(apiKeyIDStr)
+
+	if err != nil {
+		respondWithError(w, r, errBadRequest(fmt.Sprintf("Couldn't parse API key id: %v", err)))
+		return
+	}
+
+	deleted, err := apiConfig.DB.DeleteAPIKey(r.Context(), database.DeleteAPIKeyParams{
+		ID:     apiKeyID,
+		UserID: user.ID,
+	})
+
+	if err != nil {
+		respondWithError(w, r, dbError(err, "API key"))
+		return
+	}
+
+	if deleted == 0 {
+		respondWithError(w, r, ownershipError(r.Context(), sql.ErrNoRows, "API key", apiKeyID, apiConfig.DB.APIKeyExists))
+		return
+	}
+
+	respondWithJSON(w, 200, struct{}{})
+}
+
+// createAPIKey generates a key and stores its hash, returning the stored
+// row and the key in the clear
+func createAPIKey(ctx context.Context, db *database.Queries, userID uuid.UUID, name string, expiresAt sql.NullTime) (database.ApiKey, string, error) {
+	key, prefix, err := auth.GenerateAPIKey()
+	if err != nil {
+		return database.ApiKey{}, "", err
+	}
+
+	apiKey, err := db.CreateAPIKey(ctx, database.CreateAPIKeyParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now().UTC(),
+		UserID:    userID,
+		Name:      name,
+		Prefix:    prefix,
+		KeyHash:   auth.HashAPIKey(key),
+		ExpiresAt: expiresAt,
+	})
+
+	if err != nil {
+		return database.ApiKey{}, "", err
+	}
+
+	return apiKey, key, nil
+}
@@ -3,5 +3,5 @@ package main
 import "net/http"
 
 func handleErr(w http.ResponseWriter, r *http.Request) {
-	respondWithError(w, 400, "Some thing when wrong")
+	respondWithError(w, r, errBadRequest("Some thing when wrong"))
 }
@@ -1,55 +1,191 @@
 package main
 
 import (
-	"encoding/json"
+	"database/sql"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"time"
 
+	"github.com/go-chi/chi"
 	"github.com/google/uuid"
 	"github.com/hoang-cao-long/golang-side-projects/rss-services/internal/database"
 )
 
 func (apiConfig *apiConfig) handleCreateFeed(w http.ResponseWriter, r *http.Request, user database.User) {
 	type parameters struct {
-		Name string `json:"name"`
-		URL  string `json:"url"`
+		Name string `json:"name" validate:"max=200"`
+		URL  string `json:"url" validate:"required,url,max=2048"`
+		// Follow also follows the new feed, in the same transaction
+		Follow bool `json:"follow"`
 	}
 
-	decode := json.NewDecoder(r.Body)
-
 	params := parameters{}
 
-	err := decode.Decode(&params)
+	err := decodeJSONBody(w, r, &params)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	feedURL, err := normalizeFeedURL(params.URL)
+	if err != nil {
+		respondWithError(w, r, errBadRequest(fmt.Sprintf("Couldn't parse url: %v", err)))
+		return
+	}
+
+	for _, candidate := range []string{feedURL, alternateSchemeURL(feedURL)} {
+		existing, err := apiConfig.DB.GetFeedByURL(r.Context(), candidate)
+
+		if err == nil {
+			respondWithError(w, r, errConflict(fmt.Sprintf("Feed already exists: %v", existing.ID)))
+			return
+		}
+
+		if !errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, r, dbError(err, "Feed"))
+			return
+		}
+	}
+
+	// Only feeds that can actually be fetched and parsed are stored
+	fetch, err := urlToFeed(r.Context(), feedURL, "", "")
+
+	if err != nil {
+		slog.InfoContext(r.Context(), "Feed rejected", "url", feedURL, "error", err)
+		respondWithError(w, r, errUnprocessable("URL is not a reachable feed: "+fetchErrorReason(err)))
+		return
+	}
+
+	tx, err := apiConfig.DBConn.BeginTx(r.Context(), nil)
 	if err != nil {
-		respondWithError(w, 400, fmt.Sprintf("Error parsing JSON: %v", err))
+		respondWithError(w, r, errInternal(fmt.Errorf("couldn't start transaction: %w", err)))
 		return
 	}
+	defer tx.Rollback()
+
+	qtx := newQueries(tx)
 
-	feed, err := apiConfig.DB.CreateFeed(r.Context(), database.CreateFeedParams{
+	feed, err := qtx.CreateFeed(r.Context(), database.CreateFeedParams{
 		ID:        uuid.New(),
 		CreatedAt: time.Now().UTC(),
 		UpdatedAt: time.Now().UTC(),
-		Name:      params.Name,
-		Url:       params.URL,
+		Name:      firstNonEmpty(params.Name, fetch.Feed.Title, feedURL),
+		Url:       feedURL,
 		UserID:    user.ID,
 	})
 
 	if err != nil {
-		respondWithError(w, 400, fmt.Sprintf("Couldn't create feed: %v", err))
+		respondWithError(w, r, dbError(err, "Feed"))
+		return
+	}
+
+	if !params.Follow {
+		if err := tx.Commit(); err != nil {
+			respondWithError(w, r, errInternal(fmt.Errorf("couldn't commit feed: %w", err)))
+			return
+		}
+
+		respondWithJSON(w, 201, databaseFeedToFeed(feed))
+		return
+	}
+
+	feedFollow, _, err := followFeed(r.Context(), qtx, user.ID, feed.ID)
+
+	if err != nil {
+		respondWithError(w, r, dbError(err, "Feed follow"))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, r, errInternal(fmt.Errorf("couldn't commit feed: %w", err)))
+		return
+	}
+
+	type response struct {
+		Feed       Feed       `json:"feed"`
+		FeedFollow FeedFollow `json:"feed_follow"`
+	}
+
+	respondWithJSON(w, 201, response{
+		Feed:       databaseFeedToFeed(feed),
+		FeedFollow: databaseFeedFollowToFeedFollow(feedFollow),
+	})
+}
+
+func (apiConfig *apiConfig) handleDiscoverFeeds(w http.ResponseWriter, r *http.Request, user database.User) {
+	pageURL, err := normalizeFeedURL(r.URL.Query().Get("url"))
+	if err != nil {
+		respondWithError(w, r, errBadRequest(fmt.Sprintf("Couldn't parse url: %v", err)))
 		return
 	}
 
-	respondWithJSON(w, 201, databaseFeedToFeed(feed))
+	candidates, err := discoverFeeds(r.Context(), pageURL)
+
+	if err != nil {
+		slog.InfoContext(r.Context(), "Feed discovery failed", "url", pageURL, "error", err)
+		respondWithError(w, r, errUnprocessable("Couldn't discover feeds: "+fetchErrorReason(err)))
+		return
+	}
+
+	respondWithJSON(w, 200, candidates)
 }
 
 func (apiConfig *apiConfig) handleGetFeed(w http.ResponseWriter, r *http.Request) {
 	feed, err := apiConfig.DB.GetFeeds(r.Context())
 
 	if err != nil {
-		respondWithError(w, 400, fmt.Sprintf("Couldn't get feed: %v", err))
+		respondWithError(w, r, dbError(err, "Feeds"))
 		return
 	}
 
 	respondWithJSON(w, 200, databaseFeedsToFeeds(feed))
 }
+
+func (apiConfig *apiConfig) handleGetUnhealthyFeeds(w http.ResponseWriter, r *http.Request, user database.User) {
+	feeds, err := apiConfig.DB.GetUnhealthyFeedsForUser(r.Context(), user.ID)
+
+	if err != nil {
+		respondWithError(w, r, dbError(err, "Feeds"))
+		return
+	}
+
+	respondWithJSON(w, 200, databaseFeedsToFeedHealths(feeds))
+}
+
+func (apiConfig *apiConfig) handleEnableFeed(w http.ResponseWriter, r *http.Request, user database.User) {
+	feedIDStr := chi.URLParam(r, "feedID")
+	feedID, err := uuid.Parse(feedIDStr)
+
+	if err != nil {
+		respondWithError(w, r, errBadRequest(fmt.Sprintf("Couldn't parse feed id: %v", err)))
+		return
+	}
+
+	feed, err := apiConfig.DB.EnableFeed(r.Context(), database.EnableFeedParams{
+		ID:     feedID,
+		UserID: user.ID,
+	})
+
+	if err != nil {
+		respondWithError(w, r, ownershipError(r.Context(), err, "Feed", feedID, apiConfig.DB.FeedExists))
+		return
+	}
+
+	respondWithJSON(w, 200, databaseFeedToFeedHealth(feed))
+}
+
+// fetchErrorReason describes why a user supplied URL couldn't be used
+// without giving away the underlying network error, which would tell
+// which hosts and ports can be reached from the server
+func fetchErrorReason(err error) string {
+	switch {
+	case errors.Is(err, errFeedParse):
+		return "not an RSS, RDF or Atom feed"
+	case errors.Is(err, errFeedTooLarge):
+		return "feed is too large"
+	default:
+		return "couldn't be fetched"
+	}
+}
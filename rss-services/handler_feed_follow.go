@@ -1,9 +1,12 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi"
@@ -13,29 +16,32 @@ import (
 
 func (apiConfig *apiConfig) handleCreateFeedFollow(w http.ResponseWriter, r *http.Request, user database.User) {
 	type parameters struct {
-		FeedID uuid.UUID `json:"feed_id"`
+		FeedID string `json:"feed_id" validate:"required,uuid"`
 	}
 
-	decode := json.NewDecoder(r.Body)
-
 	params := parameters{}
 
-	err := decode.Decode(&params)
+	err := decodeJSONBody(w, r, &params)
 	if err != nil {
-		respondWithError(w, 400, fmt.Sprintf("Error parsing JSON: %v", err))
+		respondWithError(w, r, err)
 		return
 	}
 
-	feedFollow, err := apiConfig.DB.CreateFeedFollow(r.Context(), database.CreateFeedFollowParams{
-		ID:        uuid.New(),
-		CreatedAt: time.Now().UTC(),
-		UpdatedAt: time.Now().UTC(),
-		UserID:    user.ID,
-		FeedID:    params.FeedID,
-	})
+	feedID, err := parseUUIDField("feed_id", params.FeedID)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	feedFollow, created, err := followFeed(r.Context(), apiConfig.DB, user.ID, feedID)
 
 	if err != nil {
-		respondWithError(w, 400, fmt.Sprintf("Couldn't create feed follow: %v", err))
+		respondWithError(w, r, dbError(err, "Feed follow"))
+		return
+	}
+
+	if !created {
+		respondWithJSON(w, 200, databaseFeedFollowToFeedFollow(feedFollow))
 		return
 	}
 
@@ -43,32 +49,148 @@ func (apiConfig *apiConfig) handleCreateFeedFollow(w http.ResponseWriter, r *htt
 }
 
 func (apiConfig *apiConfig) handleGetFeedFollows(w http.ResponseWriter, r *http.Request, user database.User) {
-	feed_follows, err := apiConfig.DB.GetFeedFollows(r.Context(), user.ID)
+	folderID, err := parseUUIDQuery(r, "folder_id")
+	if err != nil {
+		respondWithError(w, r, errBadRequest(err.Error()))
+		return
+	}
+
+	feed_follows, err := apiConfig.DB.GetFeedFollows(r.Context(), database.GetFeedFollowsParams{
+		UserID:   user.ID,
+		FolderID: folderID,
+	})
 
 	if err != nil {
-		respondWithError(w, 400, fmt.Sprintf("Couldn't get feed: %v", err))
+		respondWithError(w, r, dbError(err, "Feed follows"))
 		return
 	}
 
 	respondWithJSON(w, 200, databaseFeedFollowsToFeedFollows(feed_follows))
 }
 
+// handleUpdateFeedFollow moves a follow to a folder and sets its custom
+// title. Fields left out of the body are unchanged, a null folder_id or
+// title clears them.
+func (apiConfig *apiConfig) handleUpdateFeedFollow(w http.ResponseWriter, r *http.Request, user database.User) {
+	type parameters struct {
+		FolderID optional[string] `json:"folder_id" validate:"uuid"`
+		Title    optional[string] `json:"title" validate:"max=200"`
+	}
+
+	feedFollowIDStr := chi.URLParam(r, "feedFollowID")
+	feedFollowID, err := uuid.Parse(feedFollowIDStr)
+
+	if err != nil {
+		respondWithError(w, r, errBadRequest(fmt.Sprintf("Couldn't parse feed follow id: %v", err)))
+		return
+	}
+
+	params := parameters{}
+
+	err = decodeJSONBody(w, r, &params)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	folderID := uuid.NullUUID{}
+	if params.FolderID.Value != nil {
+		id, err := parseUUIDField("folder_id", *params.FolderID.Value)
+		if err != nil {
+			respondWithError(w, r, err)
+			return
+		}
+		folderID = uuid.NullUUID{UUID: id, Valid: true}
+
+		_, err = apiConfig.DB.GetFolderForUser(r.Context(), database.GetFolderForUserParams{
+			ID:     folderID.UUID,
+			UserID: user.ID,
+		})
+
+		if err != nil {
+			respondWithError(w, r, ownershipError(r.Context(), err, "Folder", folderID.UUID, apiConfig.DB.FolderExists))
+			return
+		}
+	}
+
+	title := sql.NullString{}
+	if params.Title.Value != nil {
+		title = stringToNullString(strings.TrimSpace(*params.Title.Value))
+	}
+
+	feedFollow, err := apiConfig.DB.UpdateFeedFollow(r.Context(), database.UpdateFeedFollowParams{
+		SetFolderID: params.FolderID.Set,
+		FolderID:    folderID,
+		SetTitle:    params.Title.Set,
+		Title:       title,
+		UpdatedAt:   time.Now().UTC(),
+		ID:          feedFollowID,
+		UserID:      user.ID,
+	})
+
+	if err != nil {
+		respondWithError(w, r, ownershipError(r.Context(), err, "Feed follow", feedFollowID, apiConfig.DB.FeedFollowExists))
+		return
+	}
+
+	respondWithJSON(w, 200, databaseFeedFollowToFeedFollow(feedFollow))
+}
+
 func (apiConfig *apiConfig) handleDeleteFeedFollow(w http.ResponseWriter, r *http.Request, user database.User) {
 	feedFollowIDStr := chi.URLParam(r, "feedFollowID")
 	feedFollowID, err := uuid.Parse(feedFollowIDStr)
 
 	if err != nil {
-		respondWithError(w, 400, fmt.Sprintf("Couldn't parse feed follow id: %v", err))
+		respondWithError(w, r, errBadRequest(fmt.Sprintf("Couldn't parse feed follow id: %v", err)))
+		return
 	}
 
-	err = apiConfig.DB.DeleteFeedFollow(r.Context(), database.DeleteFeedFollowParams{
+	deleted, err := apiConfig.DB.DeleteFeedFollow(r.Context(), database.DeleteFeedFollowParams{
 		ID:     feedFollowID,
 		UserID: user.ID,
 	})
 
 	if err != nil {
-		respondWithError(w, 400, fmt.Sprintf("Couldn't delete feed follow: %v", err))
+		respondWithError(w, r, dbError(err, "Feed follow"))
+		return
+	}
+
+	if deleted == 0 {
+		respondWithError(w, r, ownershipError(r.Context(), sql.ErrNoRows, "Feed follow", feedFollowID, apiConfig.DB.FeedFollowExists))
+		return
 	}
 
 	respondWithJSON(w, 200, struct{}{})
 }
+
+// followFeed follows a feed unless the user already does, in which case
+// the existing follow is returned with created set to false
+func followFeed(ctx context.Context, db *database.Queries, userID, feedID uuid.UUID) (database.FeedFollow, bool, error) {
+	feedFollow, err := db.CreateFeedFollow(ctx, database.CreateFeedFollowParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+		UserID:    userID,
+		FeedID:    feedID,
+	})
+
+	if err == nil {
+		return feedFollow, true, nil
+	}
+
+	if !errors.Is(err, sql.ErrNoRows) {
+		return database.FeedFollow{}, false, err
+	}
+
+	// ON CONFLICT DO NOTHING returns no row when the follow exists
+	feedFollow, err = db.GetFeedFollowForFeed(ctx, database.GetFeedFollowForFeedParams{
+		UserID: userID,
+		FeedID: feedID,
+	})
+
+	if err != nil {
+		return database.FeedFollow{}, false, err
+	}
+
+	return feedFollow, false, nil
+}
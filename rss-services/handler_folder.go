@@ -0,0 +1,122 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/google/uuid"
+	"github.com/hoang-cao-long/golang-side-projects/rss-services/internal/database"
+)
+
+func (apiConfig *apiConfig) handleCreateFolder(w http.ResponseWriter, r *http.Request, user database.User) {
+	type parameters struct {
+		Name     string `json:"name" validate:"required,max=100"`
+		Position int32  `json:"position" validate:"min=0"`
+	}
+
+	params := parameters{}
+
+	err := decodeJSONBody(w, r, &params)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	folder, err := apiConfig.DB.CreateFolder(r.Context(), database.CreateFolderParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+		UserID:    user.ID,
+		Name:      strings.TrimSpace(params.Name),
+		Position:  params.Position,
+	})
+
+	if err != nil {
+		respondWithError(w, r, dbError(err, "Folder"))
+		return
+	}
+
+	respondWithJSON(w, 201, databaseFolderToFolder(folder))
+}
+
+func (apiConfig *apiConfig) handleGetFolders(w http.ResponseWriter, r *http.Request, user database.User) {
+	folders, err := apiConfig.DB.GetFoldersForUser(r.Context(), user.ID)
+
+	if err != nil {
+		respondWithError(w, r, dbError(err, "Folders"))
+		return
+	}
+
+	respondWithJSON(w, 200, databaseFoldersToFolders(folders))
+}
+
+func (apiConfig *apiConfig) handleUpdateFolder(w http.ResponseWriter, r *http.Request, user database.User) {
+	type parameters struct {
+		Name     string `json:"name" validate:"required,max=100"`
+		Position int32  `json:"position" validate:"min=0"`
+	}
+
+	folderIDStr := chi.URLParam(r, "folderID")
+	folderID, err := uuid.Parse(folderIDStr)
+
+	if err != nil {
+		respondWithError(w, r, errBadRequest(fmt.Sprintf("Couldn't parse folder id: %v", err)))
+		return
+	}
+
+	params := parameters{}
+
+	err = decodeJSONBody(w, r, &params)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	folder, err := apiConfig.DB.UpdateFolder(r.Context(), database.UpdateFolderParams{
+		Name:      strings.TrimSpace(params.Name),
+		Position:  params.Position,
+		UpdatedAt: time.Now().UTC(),
+		ID:        folderID,
+		UserID:    user.ID,
+	})
+
+	if err != nil {
+		respondWithError(w, r, ownershipError(r.Context(), err, "Folder", folderID, apiConfig.DB.FolderExists))
+		return
+	}
+
+	respondWithJSON(w, 200, databaseFolderToFolder(folder))
+}
+
+// handleDeleteFolder removes a folder, the follows inside it are kept
+// and moved out of any folder
+func (apiConfig *apiConfig) handleDeleteFolder(w http.ResponseWriter, r *http.Request, user database.User) {
+	folderIDStr := chi.URLParam(r, "folderID")
+	folderID, err := uuid.Parse(folderIDStr)
+
+	if err != nil {
+		respondWithError(w, r, errBadRequest(fmt.Sprintf("Couldn't parse folder id: %v", err)))
+		return
+	}
+
+	deleted, err := apiConfig.DB.DeleteFolder(r.Context(), database.DeleteFolderParams{
+		ID:     folderID,
+		UserID: user.ID,
+	})
+
+	if err != nil {
+		respondWithError(w, r, dbError(err, "Folder"))
+		return
+	}
+
+	if deleted == 0 {
+		respondWithError(w, r, ownershipError(r.Context(), sql.ErrNoRows, "Folder", folderID, apiConfig.DB.FolderExists))
+		return
+	}
+
+	respondWithJSON(w, 200, struct{}{})
+}
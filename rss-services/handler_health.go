@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// How long the database gets to answer a readiness ping
+const readinessDBTimeout = 2 * time.Second
+
+const (
+	healthStatusOK   = "ok"
+	healthStatusFail = "fail"
+)
+
+type healthCheck struct {
+	Status        string     `json:"status"`
+	DurationMs    int64      `json:"duration_ms,omitempty"`
+	Error         string     `json:"error,omitempty"`
+	LastSuccessAt *time.Time `json:"last_success_at,omitempty"`
+}
+
+// handleHealthz only tells the process is alive and serving, it checks no
+// dependency so a database outage doesn't get the process restarted
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, 200, struct {
+		Status string `json:"status"`
+	}{
+		Status: healthStatusOK,
+	})
+}
+
+// handleReadyz tells whether this replica should get traffic. It answers
+// 503 when the database can't be reached or the scraper stopped looping.
+func (apiConfig *apiConfig) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]healthCheck{
+		"database": apiConfig.checkDatabase(r.Context()),
+		"scraper":  apiConfig.checkScraper(),
+	}
+
+	status, code := healthStatusOK, 200
+	for _, check := range checks {
+		if check.Status != healthStatusOK {
+			status, code = healthStatusFail, 503
+		}
+	}
+
+	respondWithJSON(w, code, struct {
+		Status string                 `json:"status"`
+		Checks map[string]healthCheck `json:"checks"`
+	}{
+		Status: status,
+		Checks: checks,
+	})
+}
+
+func (apiConfig *apiConfig) checkDatabase(ctx context.Context) healthCheck {
+	ctx, cancel := context.WithTimeout(ctx, readinessDBTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := apiConfig.DBConn.PingContext(ctx)
+
+	check := healthCheck{
+		Status:     healthStatusOK,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+
+	if err != nil {
+		// The error names the database host, it is only logged
+		slog.ErrorContext(ctx, "Readiness database ping failed", "error", err)
+		check.Status = healthStatusFail
+		check.Error = "database is unreachable"
+	}
+
+	return check
+}
+
+func (apiConfig *apiConfig) checkScraper() healthCheck {
+	lastSuccess := apiConfig.Scraper.LastSuccess()
+	sinceSuccess := time.Since(lastSuccess)
+
+	check := healthCheck{
+		Status:        healthStatusOK,
+		LastSuccessAt: &lastSuccess,
+	}
+
+	if sinceSuccess > apiConfig.Scraper.StaleAfter() {
+		check.Status = healthStatusFail
+		check.Error = fmt.Sprintf("no successful scraper loop for %s", sinceSuccess.Round(time.Second))
+	}
+
+	return check
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hoang-cao-long/golang-side-projects/rss-services/internal/database"
+)
+
+const maxOPMLSize = 5 << 20
+
+const (
+	opmlStatusFollowed         = "followed"
+	opmlStatusAlreadyFollowing = "already_following"
+	opmlStatusDuplicate        = "duplicate"
+	opmlStatusInvalid          = "invalid"
+)
+
+type opmlImportResult struct {
+	Title       string     `json:"title"`
+	URL         string     `json:"url"`
+	Folder      string     `json:"folder,omitempty"`
+	Status      string     `json:"status"`
+	Error       string     `json:"error,omitempty"`
+	FeedID      *uuid.UUID `json:"feed_id,omitempty"`
+	FeedCreated bool       `json:"feed_created"`
+}
+
+// handleImportOPML creates and follows every feed of an OPML file in a
+// single transaction. The file is sent either as the raw request body or
+// as the "file" field of a multipart form.
+func (apiConfig *apiConfig) handleImportOPML(w http.ResponseWriter, r *http.Request, user database.User) {
+	dat, err := readOPMLUpload(w, r)
+
+	maxBytesErr := &http.MaxBytesError{}
+	if errors.As(err, &maxBytesErr) {
+		respondWithError(w, r, errPayloadTooLarge(fmt.Sprintf("OPML file must not be larger than %d bytes", maxBytesErr.Limit)))
+		return
+	}
+
+	if err != nil {
+		respondWithError(w, r, errBadRequest(fmt.Sprintf("Couldn't read OPML: %v", err)))
+		return
+	}
+
+	subscriptions, err := parseOPML(dat)
+	if err != nil {
+		respondWithError(w, r, errBadRequest(fmt.Sprintf("Error parsing OPML: %v", err)))
+		return
+	}
+
+	tx, err := apiConfig.DBConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, r, errInternal(fmt.Errorf("couldn't start transaction: %w", err)))
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := newQueries(tx)
+
+	results := []opmlImportResult{}
+	seen := map[string]bool{}
+	folderIDs := map[string]uuid.UUID{}
+
+	for _, subscription := range subscriptions {
+		result := opmlImportResult{
+			Title:  subscription.Title,
+			URL:    subscription.URL,
+			Folder: subscription.Folder,
+		}
+
+		feedURL, err := normalizeFeedURL(subscription.URL)
+		if err != nil {
+			result.Status = opmlStatusInvalid
+			result.Error = err.Error()
+			results = append(results, result)
+			continue
+		}
+		result.URL = feedURL
+
+		if seen[feedURL] {
+			result.Status = opmlStatusDuplicate
+			results = append(results, result)
+			continue
+		}
+		seen[feedURL] = true
+
+		feed, err := qtx.GetFeedByURL(r.Context(), feedURL)
+		if errors.Is(err, sql.ErrNoRows) {
+			feed, err = qtx.GetFeedByURL(r.Context(), alternateSchemeURL(feedURL))
+		}
+
+		if errors.Is(err, sql.ErrNoRows) {
+			feed, err = qtx.CreateFeed(r.Context(), database.CreateFeedParams{
+				ID:        uuid.New(),
+				CreatedAt: time.Now().UTC(),
+				UpdatedAt: time.Now().UTC(),
+				Name:      firstNonEmpty(subscription.Title, feedURL),
+				Url:       feedURL,
+				UserID:    user.ID,
+			})
+			result.FeedCreated = true
+		}
+
+		if err != nil {
+			respondWithError(w, r, dbError(err, "Feed"))
+			return
+		}
+
+		result.FeedID = &feed.ID
+
+		feedFollow, created, err := followFeed(r.Context(), qtx, user.ID, feed.ID)
+
+		if err != nil {
+			respondWithError(w, r, dbError(err, "Feed follow"))
+			return
+		}
+
+		if !created {
+			result.Status = opmlStatusAlreadyFollowing
+			results = append(results, result)
+			continue
+		}
+
+		if subscription.Folder != "" {
+			folderID, ok := folderIDs[subscription.Folder]
+			if !ok {
+				folderID, err = importOPMLFolder(r.Context(), qtx, user.ID, subscription.Folder)
+				if err != nil {
+					respondWithError(w, r, dbError(err, "Folder"))
+					return
+				}
+				folderIDs[subscription.Folder] = folderID
+			}
+
+			_, err = qtx.UpdateFeedFollow(r.Context(), database.UpdateFeedFollowParams{
+				SetFolderID: true,
+				FolderID:    uuid.NullUUID{UUID: folderID, Valid: true},
+				UpdatedAt:   time.Now().UTC(),
+				ID:          feedFollow.ID,
+				UserID:      user.ID,
+			})
+
+			if err != nil {
+				respondWithError(w, r, dbError(err, "Feed follow"))
+				return
+			}
+		}
+
+		result.Status = opmlStatusFollowed
+		results = append(results, result)
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, r, errInternal(fmt.Errorf("couldn't commit OPML import: %w", err)))
+		return
+	}
+
+	type response struct {
+		Results []opmlImportResult `json:"results"`
+	}
+
+	respondWithJSON(w, 200, response{Results: results})
+}
+
+func (apiConfig *apiConfig) handleExportOPML(w http.ResponseWriter, r *http.Request, user database.User) {
+	rows, err := apiConfig.DB.GetFollowedFeeds(r.Context(), user.ID)
+
+	if err != nil {
+		respondWithError(w, r, dbError(err, "Feeds"))
+		return
+	}
+
+	subscriptions := []opmlSubscription{}
+	for _, row := range rows {
+		subscriptions = append(subscriptions, opmlSubscription{
+			Title:  firstNonEmpty(row.FollowTitle.String, row.Feed.Name),
+			URL:    row.Feed.Url,
+			Folder: row.FolderName.String,
+		})
+	}
+
+	dat, err := xml.MarshalIndent(buildOPML(fmt.Sprintf("%s subscriptions", user.Name), subscriptions), "", "  ")
+	if err != nil {
+		respondWithError(w, r, errInternal(fmt.Errorf("couldn't build OPML: %w", err)))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/x-opml; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="subscriptions.opml"`)
+	w.WriteHeader(200)
+	w.Write([]byte(xml.Header))
+	w.Write(dat)
+}
+
+// importOPMLFolder returns the folder with the given name, creating it
+// when the user doesn't have one yet
+func importOPMLFolder(ctx context.Context, db *database.Queries, userID uuid.UUID, name string) (uuid.UUID, error) {
+	folder, err := db.GetFolderByName(ctx, database.GetFolderByNameParams{
+		UserID: userID,
+		Name:   name,
+	})
+
+	if err == nil {
+		return folder.ID, nil
+	}
+
+	if !errors.Is(err, sql.ErrNoRows) {
+		return uuid.Nil, err
+	}
+
+	folder, err = db.CreateFolder(ctx, database.CreateFolderParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+		UserID:    userID,
+		Name:      name,
+	})
+
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return folder.ID, nil
+}
+
+func readOPMLUpload(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxOPMLSize)
+
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		return io.ReadAll(r.Body)
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return io.ReadAll(file)
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/google/uuid"
+	"github.com/hoang-cao-long/golang-side-projects/rss-services/internal/database"
+)
+
+func (apiConfig *apiConfig) handleGetPostsForUser(w http.ResponseWriter, r *http.Request, user database.User) {
+	params := database.GetPostsForUserParams{
+		UserID: user.ID,
+	}
+
+	query := r.URL.Query()
+
+	pageSize, err := parsePageSize(r)
+	if err != nil {
+		respondWithError(w, r, errBadRequest(err.Error()))
+		return
+	}
+
+	// One extra post tells whether there is a next page
+	params.MaxPosts = int32(pageSize + 1)
+
+	params.UnreadOnly, err = parseBoolQuery(r, "unread")
+	if err != nil {
+		respondWithError(w, r, errBadRequest(err.Error()))
+		return
+	}
+
+	params.StarredOnly, err = parseBoolQuery(r, "starred")
+	if err != nil {
+		respondWithError(w, r, errBadRequest(err.Error()))
+		return
+	}
+
+	params.FeedID, err = parseUUIDQuery(r, "feed_id")
+	if err != nil {
+		respondWithError(w, r, errBadRequest(err.Error()))
+		return
+	}
+
+	params.FolderID, err = parseUUIDQuery(r, "folder_id")
+	if err != nil {
+		respondWithError(w, r, errBadRequest(err.Error()))
+		return
+	}
+
+	params.PublishedSince, err = parseTimeQuery(r, "since")
+	if err != nil {
+		respondWithError(w, r, errBadRequest(err.Error()))
+		return
+	}
+
+	params.PublishedUntil, err = parseTimeQuery(r, "until")
+	if err != nil {
+		respondWithError(w, r, errBadRequest(err.Error()))
+		return
+	}
+
+	if value := query.Get("title"); value != "" {
+		params.TitlePattern = sql.NullString{String: "%" + escapeLikePattern(value) + "%", Valid: true}
+	}
+
+	if value := query.Get("cursor"); value != "" {
+		cursor, err := decodePostCursor(value)
+		if err != nil {
+			respondWithError(w, r, errBadRequest(err.Error()))
+			return
+		}
+		params.CursorPublishedAt = sql.NullTime{Time: cursor.PublishedAt, Valid: true}
+		params.CursorID = uuid.NullUUID{UUID: cursor.ID, Valid: true}
+	}
+
+	posts, err := apiConfig.DB.GetPostsForUser(r.Context(), params)
+
+	if err != nil {
+		respondWithError(w, r, dbError(err, "Posts"))
+		return
+	}
+
+	if len(posts) > pageSize {
+		posts = posts[:pageSize]
+		last := posts[len(posts)-1]
+		setNextPageLink(w, r, postCursor{PublishedAt: last.PublishedAt, ID: last.ID})
+	}
+
+	respondWithJSON(w, 200, databasePostsForUserToPosts(posts))
+}
+
+func (apiConfig *apiConfig) handleSearchPosts(w http.ResponseWriter, r *http.Request, user database.User) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		respondWithError(w, r, errBadRequest("Missing search query q"))
+		return
+	}
+
+	pageSize, err := parsePageSize(r)
+	if err != nil {
+		respondWithError(w, r, errBadRequest(err.Error()))
+		return
+	}
+
+	results, err := apiConfig.DB.SearchPostsForUser(r.Context(), database.SearchPostsForUserParams{
+		Query:    query,
+		UserID:   user.ID,
+		MaxPosts: int32(pageSize),
+	})
+
+	if err != nil {
+		respondWithError(w, r, dbError(err, "Posts"))
+		return
+	}
+
+	respondWithJSON(w, 200, databaseSearchResultsToPostSearchResults(results))
+}
+
+func (apiConfig *apiConfig) handleMarkPostRead(w http.ResponseWriter, r *http.Request, user database.User) {
+	post, ok := apiConfig.getPostForUser(w, r, user)
+	if !ok {
+		return
+	}
+
+	err := apiConfig.DB.MarkPostRead(r.Context(), database.MarkPostReadParams{
+		UserID:    user.ID,
+		PostID:    post.ID,
+		CreatedAt: time.Now().UTC(),
+	})
+
+	if err != nil {
+		respondWithError(w, r, dbError(err, "Post"))
+		return
+	}
+
+	post.Read = true
+	respondWithJSON(w, 200, databasePostForUserToPost(post))
+}
+
+func (apiConfig *apiConfig) handleMarkPostUnread(w http.ResponseWriter, r *http.Request, user database.User) {
+	post, ok := apiConfig.getPostForUser(w, r, user)
+	if !ok {
+		return
+	}
+
+	err := apiConfig.DB.MarkPostUnread(r.Context(), database.MarkPostUnreadParams{
+		UserID: user.ID,
+		PostID: post.ID,
+	})
+
+	if err != nil {
+		respondWithError(w, r, dbError(err, "Post"))
+		return
+	}
+
+	post.Read = false
+	respondWithJSON(w, 200, databasePostForUserToPost(post))
+}
+
+func (apiConfig *apiConfig) handleMarkFeedPostsRead(w http.ResponseWriter, r *http.Request, user database.User) {
+	type parameters struct {
+		FeedID string     `json:"feed_id" validate:"required,uuid"`
+		Before *time.Time `json:"before"`
+	}
+
+	params := parameters{}
+
+	err := decodeJSONBody(w, r, &params)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	feedID, err := parseUUIDField("feed_id", params.FeedID)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	before := time.Now().UTC()
+	if params.Before != nil {
+		before = params.Before.UTC()
+	}
+
+	marked, err := apiConfig.DB.MarkFeedPostsReadBefore(r.Context(), database.MarkFeedPostsReadBeforeParams{
+		CreatedAt: time.Now().UTC(),
+		UserID:    user.ID,
+		FeedID:    feedID,
+		Before:    before,
+	})
+
+	if err != nil {
+		respondWithError(w, r, dbError(err, "Posts"))
+		return
+	}
+
+	type response struct {
+		Marked int64 `json:"marked"`
+	}
+
+	respondWithJSON(w, 200, response{Marked: marked})
+}
+
+func (apiConfig *apiConfig) handleStarPost(w http.ResponseWriter, r *http.Request, user database.User) {
+	post, ok := apiConfig.getPostForUser(w, r, user)
+	if !ok {
+		return
+	}
+
+	err := apiConfig.DB.StarPost(r.Context(), database.StarPostParams{
+		UserID:    user.ID,
+		PostID:    post.ID,
+		CreatedAt: time.Now().UTC(),
+	})
+
+	if err != nil {
+		respondWithError(w, r, dbError(err, "Post"))
+		return
+	}
+
+	post.Starred = true
+	respondWithJSON(w, 200, databasePostForUserToPost(post))
+}
+
+func (apiConfig *apiConfig) handleUnstarPost(w http.ResponseWriter, r *http.Request, user database.User) {
+	post, ok := apiConfig.getPostForUser(w, r, user)
+	if !ok {
+		return
+	}
+
+	err := apiConfig.DB.UnstarPost(r.Context(), database.UnstarPostParams{
+		UserID: user.ID,
+		PostID: post.ID,
+	})
+
+	if err != nil {
+		respondWithError(w, r, dbError(err, "Post"))
+		return
+	}
+
+	post.Starred = false
+	respondWithJSON(w, 200, databasePostForUserToPost(post))
+}
+
+// getPostForUser loads the post in the {postID} URL parameter, responding
+// with an error when it is not in a feed the user follows
+func (apiConfig *apiConfig) getPostForUser(w http.ResponseWriter, r *http.Request, user database.User) (database.GetPostForUserRow, bool) {
+	postIDStr := chi.URLParam(r, "postID")
+	postID, err := uuid.Parse(postIDStr)
+
+	if err != nil {
+		respondWithError(w, r, errBadRequest(fmt.Sprintf("Couldn't parse post id: %v", err)))
+		return database.GetPostForUserRow{}, false
+	}
+
+	post, err := apiConfig.DB.GetPostForUser(r.Context(), database.GetPostForUserParams{
+		ID:     postID,
+		UserID: user.ID,
+	})
+
+	if err != nil {
+		respondWithError(w, r, dbError(err, "Post"))
+		return database.GetPostForUserRow{}, false
+	}
+
+	return post, true
+}
+
+// parseBoolQuery reads an optional boolean query parameter
+func parseBoolQuery(r *http.Request, name string) (bool, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid value %q for %s, expected true or false", value, name)
+	}
+
+	return b, nil
+}
+
+// parseUUIDQuery reads an optional UUID query parameter
+func parseUUIDQuery(r *http.Request, name string) (uuid.NullUUID, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return uuid.NullUUID{}, nil
+	}
+
+	id, err := uuid.Parse(value)
+	if err != nil {
+		return uuid.NullUUID{}, fmt.Errorf("invalid value %q for %s, expected a uuid", value, name)
+	}
+
+	return uuid.NullUUID{UUID: id, Valid: true}, nil
+}
+
+// parseTimeQuery reads an optional RFC 3339 query parameter
+func parseTimeQuery(r *http.Request, name string) (sql.NullTime, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return sql.NullTime{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return sql.NullTime{}, fmt.Errorf("invalid value %q for %s, expected an RFC 3339 time", value, name)
+	}
+
+	return sql.NullTime{Time: t.UTC(), Valid: true}, nil
+}
+
+// escapeLikePattern makes % and _ in user input match literally
+func escapeLikePattern(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
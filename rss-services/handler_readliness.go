@@ -1,7 +0,0 @@
-package main
-
-import "net/http"
-
-func handleReadliness(w http.ResponseWriter, r *http.Request) {
-	respondWithJSON(w, 200, struct{}{})
-}
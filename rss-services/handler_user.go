@@ -1,9 +1,10 @@
 package main
 
 import (
-	"encoding/json"
+	"database/sql"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -12,48 +13,62 @@ import (
 
 func (apiConfig *apiConfig) handleCreateUser(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
-		Name string `json:"name"`
+		Name string `json:"name" validate:"required,max=100"`
 	}
 
-	decode := json.NewDecoder(r.Body)
-
 	params := parameters{}
 
-	err := decode.Decode(&params)
+	err := decodeJSONBody(w, r, &params)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	tx, err := apiConfig.DBConn.BeginTx(r.Context(), nil)
 	if err != nil {
-		respondWithError(w, 400, fmt.Sprintf("Error parsing JSON: %v", err))
+		respondWithError(w, r, errInternal(fmt.Errorf("couldn't start transaction: %w", err)))
 		return
 	}
+	defer tx.Rollback()
+
+	qtx := newQueries(tx)
 
-	user, err := apiConfig.DB.CreateUser(r.Context(), database.CreateUserParams{
+	user, err := qtx.CreateUser(r.Context(), database.CreateUserParams{
 		ID:        uuid.New(),
 		CreatedAt: time.Now().UTC(),
 		UpdatedAt: time.Now().UTC(),
-		Name:      params.Name,
+		Name:      strings.TrimSpace(params.Name),
 	})
 
 	if err != nil {
-		respondWithError(w, 400, fmt.Sprintf("Couldn't create user: %v", err))
+		respondWithError(w, r, dbError(err, "User"))
 		return
 	}
 
-	respondWithJSON(w, 201, databaseUserToUser(user))
-}
-
-func (apiConfig *apiConfig) handleGetUser(w http.ResponseWriter, r *http.Request, user database.User) {
-	respondWithJSON(w, 200, databaseUserToUser(user))
-}
-
-func (apiConfig *apiConfig) handleGetPostsForUser(w http.ResponseWriter, r *http.Request, user database.User) {
-	posts, err := apiConfig.DB.GetPostsForUser(r.Context(), database.GetPostsForUserParams{
-		UserID: user.ID,
-		Limit:  10,
-	})
+	// A new user gets a first key, otherwise they couldn't authenticate
+	_, key, err := createAPIKey(r.Context(), qtx, user.ID, "default", sql.NullTime{})
 
 	if err != nil {
-		respondWithError(w, 400, fmt.Sprintf("Couldn't get post: %v", err))
+		respondWithError(w, r, dbError(err, "API key"))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, r, errInternal(fmt.Errorf("couldn't commit user: %w", err)))
 		return
 	}
 
-	respondWithJSON(w, 200, databasePostsToPosts(posts))
+	type response struct {
+		User
+		APIKey string `json:"api_key"`
+	}
+
+	respondWithJSON(w, 201, response{
+		User:   databaseUserToUser(user),
+		APIKey: key,
+	})
+}
+
+func (apiConfig *apiConfig) handleGetUser(w http.ResponseWriter, r *http.Request, user database.User) {
+	respondWithJSON(w, 200, databaseUserToUser(user))
 }
@@ -1,11 +1,22 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"net/http"
 	"strings"
 )
 
+const (
+	apiKeyScheme = "rss_"
+	// Bytes of randomness in a key
+	apiKeySize = 32
+	// Characters of a key kept in the clear to tell keys apart
+	apiKeyPrefixLen = len(apiKeyScheme) + 8
+)
+
 // GetAPIkey extracts an API key from
 // the headers of an HTTP request
 // Example:
@@ -27,3 +38,23 @@ func GetAPIkey(headers http.Header) (string, error) {
 
 	return vals[1], nil
 }
+
+// GenerateAPIKey returns a new random API key along with its prefix,
+// which can be shown to identify the key after it is created
+func GenerateAPIKey() (key string, prefix string, err error) {
+	buf := make([]byte, apiKeySize)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+
+	key = apiKeyScheme + hex.EncodeToString(buf)
+
+	return key, key[:apiKeyPrefixLen], nil
+}
+
+// HashAPIKey returns the hex SHA-256 of a key. Keys are random enough
+// that a fast unsalted hash is safe, and it can be looked up directly.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -7,16 +7,84 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+const claimFeedsToFetch = `-- name: ClaimFeedsToFetch :many
+UPDATE feeds
+SET claimed_by = $1,
+    claimed_until = NOW() + $2::int * INTERVAL '1 second',
+    last_fetched_at = NOW(),
+    updated_at = NOW()
+WHERE id IN (
+    SELECT id FROM feeds
+    WHERE active
+        AND (next_fetch_at IS NULL OR next_fetch_at <= NOW())
+        AND (claimed_until IS NULL OR claimed_until < NOW())
+    ORDER BY next_fetch_at ASC NULLS FIRST, last_fetched_at ASC NULLS FIRST
+    LIMIT $3
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, next_fetch_at, consecutive_failures, last_error, last_success_at, active, claimed_by, claimed_until
+`
+
+type ClaimFeedsToFetchParams struct {
+	ClaimedBy    sql.NullString
+	LeaseSeconds int32
+	MaxFeeds     int32
+}
+
+// Leases due feeds to one scraper replica. Rows locked by another
+// replica's claim are skipped, and an expired lease makes the feed
+// claimable again if that replica died mid-scrape.
+func (q *Queries) ClaimFeedsToFetch(ctx context.Context, arg ClaimFeedsToFetchParams) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, claimFeedsToFetch, arg.ClaimedBy, arg.LeaseSeconds, arg.MaxFeeds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.Url,
+			&i.UserID,
+			&i.LastFetchedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.NextFetchAt,
+			&i.ConsecutiveFailures,
+			&i.LastError,
+			&i.LastSuccessAt,
+			&i.Active,
+			&i.ClaimedBy,
+			&i.ClaimedUntil,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const createFeed = `-- name: CreateFeed :one
 INSERT INTO feeds
     (id, created_at, updated_at, name, url, user_id)
 values($1, $2, $3, $4, $5 , $6)
-RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, next_fetch_at, consecutive_failures, last_error, last_success_at, active, claimed_by, claimed_until
 `
 
 type CreateFeedParams struct {
@@ -46,12 +114,96 @@ func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, e
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.NextFetchAt,
+		&i.ConsecutiveFailures,
+		&i.LastError,
+		&i.LastSuccessAt,
+		&i.Active,
+		&i.ClaimedBy,
+		&i.ClaimedUntil,
+	)
+	return i, err
+}
+
+const enableFeed = `-- name: EnableFeed :one
+UPDATE feeds
+SET active = TRUE, consecutive_failures = 0, last_error = NULL, next_fetch_at = NULL, updated_at = NOW()
+WHERE id = $1 AND user_id = $2
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, next_fetch_at, consecutive_failures, last_error, last_success_at, active, claimed_by, claimed_until
+`
+
+type EnableFeedParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+func (q *Queries) EnableFeed(ctx context.Context, arg EnableFeedParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, enableFeed, arg.ID, arg.UserID)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.NextFetchAt,
+		&i.ConsecutiveFailures,
+		&i.LastError,
+		&i.LastSuccessAt,
+		&i.Active,
+		&i.ClaimedBy,
+		&i.ClaimedUntil,
+	)
+	return i, err
+}
+
+const feedExists = `-- name: FeedExists :one
+SELECT EXISTS (SELECT 1 FROM feeds WHERE id = $1)::bool
+`
+
+func (q *Queries) FeedExists(ctx context.Context, id uuid.UUID) (bool, error) {
+	row := q.db.QueryRowContext(ctx, feedExists, id)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const getFeedByURL = `-- name: GetFeedByURL :one
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, next_fetch_at, consecutive_failures, last_error, last_success_at, active, claimed_by, claimed_until FROM feeds WHERE url = $1
+`
+
+func (q *Queries) GetFeedByURL(ctx context.Context, url string) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, getFeedByURL, url)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.NextFetchAt,
+		&i.ConsecutiveFailures,
+		&i.LastError,
+		&i.LastSuccessAt,
+		&i.Active,
+		&i.ClaimedBy,
+		&i.ClaimedUntil,
 	)
 	return i, err
 }
 
 const getFeeds = `-- name: GetFeeds :many
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at FROM feeds
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, next_fetch_at, consecutive_failures, last_error, last_success_at, active, claimed_by, claimed_until FROM feeds
 `
 
 func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
@@ -71,6 +223,15 @@ func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
 			&i.Url,
 			&i.UserID,
 			&i.LastFetchedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.NextFetchAt,
+			&i.ConsecutiveFailures,
+			&i.LastError,
+			&i.LastSuccessAt,
+			&i.Active,
+			&i.ClaimedBy,
+			&i.ClaimedUntil,
 		); err != nil {
 			return nil, err
 		}
@@ -85,14 +246,29 @@ func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
 	return items, nil
 }
 
-const getNextFeedToFetch = `-- name: GetNextFeedToFetch :many
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at FROM feeds
-ORDER BY last_fetched_at ASC NULLS FIRST
-LIMIT $1
+const getScraperQueueLag = `-- name: GetScraperQueueLag :one
+SELECT COALESCE(EXTRACT(EPOCH FROM NOW() - MIN(COALESCE(next_fetch_at, updated_at))), 0)::float8 AS lag_seconds
+FROM feeds
+WHERE active AND (next_fetch_at IS NULL OR next_fetch_at <= NOW())
 `
 
-func (q *Queries) GetNextFeedToFetch(ctx context.Context, limit int32) ([]Feed, error) {
-	rows, err := q.db.QueryContext(ctx, getNextFeedToFetch, limit)
+// How long the longest waiting due feed has been due, 0 when none is.
+// Feeds without a next fetch are due since they were added or enabled.
+func (q *Queries) GetScraperQueueLag(ctx context.Context) (float64, error) {
+	row := q.db.QueryRowContext(ctx, getScraperQueueLag)
+	var lag_seconds float64
+	err := row.Scan(&lag_seconds)
+	return lag_seconds, err
+}
+
+const getUnhealthyFeedsForUser = `-- name: GetUnhealthyFeedsForUser :many
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, next_fetch_at, consecutive_failures, last_error, last_success_at, active, claimed_by, claimed_until FROM feeds
+WHERE user_id = $1 AND (NOT active OR consecutive_failures > 0)
+ORDER BY active ASC, consecutive_failures DESC
+`
+
+func (q *Queries) GetUnhealthyFeedsForUser(ctx context.Context, userID uuid.UUID) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, getUnhealthyFeedsForUser, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -108,6 +284,15 @@ func (q *Queries) GetNextFeedToFetch(ctx context.Context, limit int32) ([]Feed,
 			&i.Url,
 			&i.UserID,
 			&i.LastFetchedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.NextFetchAt,
+			&i.ConsecutiveFailures,
+			&i.LastError,
+			&i.LastSuccessAt,
+			&i.Active,
+			&i.ClaimedBy,
+			&i.ClaimedUntil,
 		); err != nil {
 			return nil, err
 		}
@@ -122,15 +307,24 @@ func (q *Queries) GetNextFeedToFetch(ctx context.Context, limit int32) ([]Feed,
 	return items, nil
 }
 
-const markFeedAsFetched = `-- name: MarkFeedAsFetched :one
+const recordFeedFailure = `-- name: RecordFeedFailure :one
 UPDATE feeds
-SET last_fetched_at = NOW(), updated_at = NOW()
-WHERE id = $1
-RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at
+SET consecutive_failures = consecutive_failures + 1,
+    last_error = $1,
+    active = consecutive_failures + 1 < $2::int,
+    updated_at = NOW()
+WHERE id = $3
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, next_fetch_at, consecutive_failures, last_error, last_success_at, active, claimed_by, claimed_until
 `
 
-func (q *Queries) MarkFeedAsFetched(ctx context.Context, id uuid.UUID) (Feed, error) {
-	row := q.db.QueryRowContext(ctx, markFeedAsFetched, id)
+type RecordFeedFailureParams struct {
+	LastError   sql.NullString
+	MaxFailures int32
+	ID          uuid.UUID
+}
+
+func (q *Queries) RecordFeedFailure(ctx context.Context, arg RecordFeedFailureParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, recordFeedFailure, arg.LastError, arg.MaxFailures, arg.ID)
 	var i Feed
 	err := row.Scan(
 		&i.ID,
@@ -140,6 +334,75 @@ func (q *Queries) MarkFeedAsFetched(ctx context.Context, id uuid.UUID) (Feed, er
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.NextFetchAt,
+		&i.ConsecutiveFailures,
+		&i.LastError,
+		&i.LastSuccessAt,
+		&i.Active,
+		&i.ClaimedBy,
+		&i.ClaimedUntil,
 	)
 	return i, err
 }
+
+const recordFeedSuccess = `-- name: RecordFeedSuccess :exec
+UPDATE feeds
+SET consecutive_failures = 0, last_error = NULL, last_success_at = NOW(), updated_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) RecordFeedSuccess(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, recordFeedSuccess, id)
+	return err
+}
+
+const releaseFeedClaim = `-- name: ReleaseFeedClaim :exec
+UPDATE feeds
+SET claimed_by = NULL, claimed_until = NULL
+WHERE id = $1 AND claimed_by = $2
+`
+
+type ReleaseFeedClaimParams struct {
+	ID        uuid.UUID
+	ClaimedBy sql.NullString
+}
+
+func (q *Queries) ReleaseFeedClaim(ctx context.Context, arg ReleaseFeedClaimParams) error {
+	_, err := q.db.ExecContext(ctx, releaseFeedClaim, arg.ID, arg.ClaimedBy)
+	return err
+}
+
+const scheduleFeedFetch = `-- name: ScheduleFeedFetch :exec
+UPDATE feeds
+SET next_fetch_at = NOW() + $1::int * INTERVAL '1 second'
+WHERE id = $2
+`
+
+type ScheduleFeedFetchParams struct {
+	IntervalSeconds int32
+	ID              uuid.UUID
+}
+
+func (q *Queries) ScheduleFeedFetch(ctx context.Context, arg ScheduleFeedFetchParams) error {
+	_, err := q.db.ExecContext(ctx, scheduleFeedFetch, arg.IntervalSeconds, arg.ID)
+	return err
+}
+
+const updateFeedCacheValidators = `-- name: UpdateFeedCacheValidators :exec
+UPDATE feeds
+SET etag = $2, last_modified = $3, updated_at = NOW()
+WHERE id = $1
+`
+
+type UpdateFeedCacheValidatorsParams struct {
+	ID           uuid.UUID
+	Etag         sql.NullString
+	LastModified sql.NullString
+}
+
+func (q *Queries) UpdateFeedCacheValidators(ctx context.Context, arg UpdateFeedCacheValidatorsParams) error {
+	_, err := q.db.ExecContext(ctx, updateFeedCacheValidators, arg.ID, arg.Etag, arg.LastModified)
+	return err
+}
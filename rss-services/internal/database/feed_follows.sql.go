@@ -7,6 +7,7 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
@@ -16,7 +17,8 @@ const createFeedFollow = `-- name: CreateFeedFollow :one
 INSERT INTO feed_follows
     (id, created_at, updated_at, user_id, feed_id)
 values($1, $2, $3, $4, $5)
-RETURNING id, created_at, updated_at, user_id, feed_id
+ON CONFLICT (user_id, feed_id) DO NOTHING
+RETURNING id, created_at, updated_at, user_id, feed_id, folder_id, title
 `
 
 type CreateFeedFollowParams struct {
@@ -42,11 +44,13 @@ func (q *Queries) CreateFeedFollow(ctx context.Context, arg CreateFeedFollowPara
 		&i.UpdatedAt,
 		&i.UserID,
 		&i.FeedID,
+		&i.FolderID,
+		&i.Title,
 	)
 	return i, err
 }
 
-const deleteFeedFollow = `-- name: DeleteFeedFollow :exec
+const deleteFeedFollow = `-- name: DeleteFeedFollow :execrows
 DELETE FROM feed_follows WHERE id = $1 AND user_id = $2
 `
 
@@ -55,17 +59,62 @@ type DeleteFeedFollowParams struct {
 	UserID uuid.UUID
 }
 
-func (q *Queries) DeleteFeedFollow(ctx context.Context, arg DeleteFeedFollowParams) error {
-	_, err := q.db.ExecContext(ctx, deleteFeedFollow, arg.ID, arg.UserID)
-	return err
+func (q *Queries) DeleteFeedFollow(ctx context.Context, arg DeleteFeedFollowParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteFeedFollow, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const feedFollowExists = `-- name: FeedFollowExists :one
+SELECT EXISTS (SELECT 1 FROM feed_follows WHERE id = $1)::bool
+`
+
+func (q *Queries) FeedFollowExists(ctx context.Context, id uuid.UUID) (bool, error) {
+	row := q.db.QueryRowContext(ctx, feedFollowExists, id)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const getFeedFollowForFeed = `-- name: GetFeedFollowForFeed :one
+SELECT id, created_at, updated_at, user_id, feed_id, folder_id, title FROM feed_follows WHERE user_id = $1 AND feed_id = $2
+`
+
+type GetFeedFollowForFeedParams struct {
+	UserID uuid.UUID
+	FeedID uuid.UUID
+}
+
+func (q *Queries) GetFeedFollowForFeed(ctx context.Context, arg GetFeedFollowForFeedParams) (FeedFollow, error) {
+	row := q.db.QueryRowContext(ctx, getFeedFollowForFeed, arg.UserID, arg.FeedID)
+	var i FeedFollow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.FeedID,
+		&i.FolderID,
+		&i.Title,
+	)
+	return i, err
 }
 
 const getFeedFollows = `-- name: GetFeedFollows :many
-SELECT id, created_at, updated_at, user_id, feed_id FROM feed_follows WHERE user_id = $1
+SELECT id, created_at, updated_at, user_id, feed_id, folder_id, title FROM feed_follows
+WHERE user_id = $1
+    AND ($2::uuid IS NULL OR folder_id = $2)
 `
 
-func (q *Queries) GetFeedFollows(ctx context.Context, userID uuid.UUID) ([]FeedFollow, error) {
-	rows, err := q.db.QueryContext(ctx, getFeedFollows, userID)
+type GetFeedFollowsParams struct {
+	UserID   uuid.UUID
+	FolderID uuid.NullUUID
+}
+
+func (q *Queries) GetFeedFollows(ctx context.Context, arg GetFeedFollowsParams) ([]FeedFollow, error) {
+	rows, err := q.db.QueryContext(ctx, getFeedFollows, arg.UserID, arg.FolderID)
 	if err != nil {
 		return nil, err
 	}
@@ -79,6 +128,8 @@ func (q *Queries) GetFeedFollows(ctx context.Context, userID uuid.UUID) ([]FeedF
 			&i.UpdatedAt,
 			&i.UserID,
 			&i.FeedID,
+			&i.FolderID,
+			&i.Title,
 		); err != nil {
 			return nil, err
 		}
@@ -92,3 +143,104 @@ func (q *Queries) GetFeedFollows(ctx context.Context, userID uuid.UUID) ([]FeedF
 	}
 	return items, nil
 }
+
+const getFollowedFeeds = `-- name: GetFollowedFeeds :many
+SELECT feeds.id, feeds.created_at, feeds.updated_at, feeds.name, feeds.url, feeds.user_id, feeds.last_fetched_at, feeds.etag, feeds.last_modified, feeds.next_fetch_at, feeds.consecutive_failures, feeds.last_error, feeds.last_success_at, feeds.active, feeds.claimed_by, feeds.claimed_until, feed_follows.title AS follow_title, folders.name AS folder_name
+FROM feeds
+JOIN feed_follows ON feeds.id = feed_follows.feed_id
+LEFT JOIN folders ON folders.id = feed_follows.folder_id
+WHERE feed_follows.user_id = $1
+ORDER BY folders.position NULLS FIRST, folders.name NULLS FIRST, feeds.name
+`
+
+type GetFollowedFeedsRow struct {
+	Feed        Feed
+	FollowTitle sql.NullString
+	FolderName  sql.NullString
+}
+
+func (q *Queries) GetFollowedFeeds(ctx context.Context, userID uuid.UUID) ([]GetFollowedFeedsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getFollowedFeeds, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetFollowedFeedsRow
+	for rows.Next() {
+		var i GetFollowedFeedsRow
+		if err := rows.Scan(
+			&i.Feed.ID,
+			&i.Feed.CreatedAt,
+			&i.Feed.UpdatedAt,
+			&i.Feed.Name,
+			&i.Feed.Url,
+			&i.Feed.UserID,
+			&i.Feed.LastFetchedAt,
+			&i.Feed.Etag,
+			&i.Feed.LastModified,
+			&i.Feed.NextFetchAt,
+			&i.Feed.ConsecutiveFailures,
+			&i.Feed.LastError,
+			&i.Feed.LastSuccessAt,
+			&i.Feed.Active,
+			&i.Feed.ClaimedBy,
+			&i.Feed.ClaimedUntil,
+			&i.FollowTitle,
+			&i.FolderName,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateFeedFollow = `-- name: UpdateFeedFollow :one
+UPDATE feed_follows
+SET folder_id = CASE WHEN $1::bool THEN $2::uuid ELSE folder_id END,
+    title = CASE WHEN $3::bool THEN $4::text ELSE title END,
+    updated_at = $5
+WHERE id = $6 AND user_id = $7
+RETURNING id, created_at, updated_at, user_id, feed_id, folder_id, title
+`
+
+type UpdateFeedFollowParams struct {
+	SetFolderID bool
+	FolderID    uuid.NullUUID
+	SetTitle    bool
+	Title       sql.NullString
+	UpdatedAt   time.Time
+	ID          uuid.UUID
+	UserID      uuid.UUID
+}
+
+// Only the fields whose set_ flag is true are changed, the others keep
+// their current value.
+func (q *Queries) UpdateFeedFollow(ctx context.Context, arg UpdateFeedFollowParams) (FeedFollow, error) {
+	row := q.db.QueryRowContext(ctx, updateFeedFollow,
+		arg.SetFolderID,
+		arg.FolderID,
+		arg.SetTitle,
+		arg.Title,
+		arg.UpdatedAt,
+		arg.ID,
+		arg.UserID,
+	)
+	var i FeedFollow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.FeedID,
+		&i.FolderID,
+		&i.Title,
+	)
+	return i, err
+}
@@ -11,46 +11,54 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
-const createPost = `-- name: CreatePost :one
-INSERT INTO posts(
-    id,
-    created_at,
-    updated_at,
-    title,
-    description,
-    published_at,
-    url,
-    feed_id)
-values($1, $2, $3, $4, $5, $6, $7, $8
-)
-RETURNING id, created_at, updated_at, title, description, published_at, url, feed_id
+const getPostForUser = `-- name: GetPostForUser :one
+SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.description, posts.published_at, posts.url, posts.feed_id, posts.published_at_source, posts.item_key, posts.guid, posts.author, posts.categories, posts.content, posts.enclosure_url, posts.enclosure_type, posts.enclosure_length,
+    EXISTS (
+        SELECT 1 FROM post_reads
+        WHERE post_reads.post_id = posts.id AND post_reads.user_id = feed_follows.user_id
+    )::bool AS read,
+    EXISTS (
+        SELECT 1 FROM post_stars
+        WHERE post_stars.post_id = posts.id AND post_stars.user_id = feed_follows.user_id
+    )::bool AS starred
+FROM posts
+JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
+WHERE posts.id = $1 AND feed_follows.user_id = $2
 `
 
-type CreatePostParams struct {
-	ID          uuid.UUID
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	Title       string
-	Description sql.NullString
-	PublishedAt time.Time
-	Url         string
-	FeedID      uuid.UUID
+type GetPostForUserParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
 }
 
-func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, error) {
-	row := q.db.QueryRowContext(ctx, createPost,
-		arg.ID,
-		arg.CreatedAt,
-		arg.UpdatedAt,
-		arg.Title,
-		arg.Description,
-		arg.PublishedAt,
-		arg.Url,
-		arg.FeedID,
-	)
-	var i Post
+type GetPostForUserRow struct {
+	ID                uuid.UUID
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	Title             string
+	Description       sql.NullString
+	PublishedAt       time.Time
+	Url               string
+	FeedID            uuid.UUID
+	PublishedAtSource string
+	ItemKey           string
+	Guid              sql.NullString
+	Author            sql.NullString
+	Categories        []string
+	Content           sql.NullString
+	EnclosureUrl      sql.NullString
+	EnclosureType     sql.NullString
+	EnclosureLength   sql.NullInt64
+	Read              bool
+	Starred           bool
+}
+
+func (q *Queries) GetPostForUser(ctx context.Context, arg GetPostForUserParams) (GetPostForUserRow, error) {
+	row := q.db.QueryRowContext(ctx, getPostForUser, arg.ID, arg.UserID)
+	var i GetPostForUserRow
 	err := row.Scan(
 		&i.ID,
 		&i.CreatedAt,
@@ -60,32 +68,274 @@ func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, e
 		&i.PublishedAt,
 		&i.Url,
 		&i.FeedID,
+		&i.PublishedAtSource,
+		&i.ItemKey,
+		&i.Guid,
+		&i.Author,
+		pq.Array(&i.Categories),
+		&i.Content,
+		&i.EnclosureUrl,
+		&i.EnclosureType,
+		&i.EnclosureLength,
+		&i.Read,
+		&i.Starred,
 	)
 	return i, err
 }
 
 const getPostsForUser = `-- name: GetPostsForUser :many
-SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.description, posts.published_at, posts.url, posts.feed_id from posts
+SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.description, posts.published_at, posts.url, posts.feed_id, posts.published_at_source, posts.item_key, posts.guid, posts.author, posts.categories, posts.content, posts.enclosure_url, posts.enclosure_type, posts.enclosure_length,
+    EXISTS (
+        SELECT 1 FROM post_reads
+        WHERE post_reads.post_id = posts.id AND post_reads.user_id = feed_follows.user_id
+    )::bool AS read,
+    EXISTS (
+        SELECT 1 FROM post_stars
+        WHERE post_stars.post_id = posts.id AND post_stars.user_id = feed_follows.user_id
+    )::bool AS starred
+FROM posts
 JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
 WHERE feed_follows.user_id = $1
-ORDER BY posts.published_at DESC
-LIMIT $2
+    AND (NOT $2::bool OR NOT EXISTS (
+        SELECT 1 FROM post_reads
+        WHERE post_reads.post_id = posts.id AND post_reads.user_id = feed_follows.user_id
+    ))
+    AND (NOT $3::bool OR EXISTS (
+        SELECT 1 FROM post_stars
+        WHERE post_stars.post_id = posts.id AND post_stars.user_id = feed_follows.user_id
+    ))
+    AND ($4::uuid IS NULL OR posts.feed_id = $4)
+    AND ($5::uuid IS NULL OR feed_follows.folder_id = $5)
+    AND ($6::timestamp IS NULL OR posts.published_at >= $6)
+    AND ($7::timestamp IS NULL OR posts.published_at < $7)
+    AND ($8::text IS NULL OR posts.title ILIKE $8)
+    AND ($9::timestamp IS NULL
+        OR (posts.published_at, posts.id) < ($9, $10::uuid))
+ORDER BY posts.published_at DESC, posts.id DESC
+LIMIT $11
 `
 
 type GetPostsForUserParams struct {
-	UserID uuid.UUID
+	UserID            uuid.UUID
+	UnreadOnly        bool
+	StarredOnly       bool
+	FeedID            uuid.NullUUID
+	FolderID          uuid.NullUUID
+	PublishedSince    sql.NullTime
+	PublishedUntil    sql.NullTime
+	TitlePattern      sql.NullString
+	CursorPublishedAt sql.NullTime
+	CursorID          uuid.NullUUID
+	MaxPosts          int32
+}
+
+type GetPostsForUserRow struct {
+	ID                uuid.UUID
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	Title             string
+	Description       sql.NullString
+	PublishedAt       time.Time
+	Url               string
+	FeedID            uuid.UUID
+	PublishedAtSource string
+	ItemKey           string
+	Guid              sql.NullString
+	Author            sql.NullString
+	Categories        []string
+	Content           sql.NullString
+	EnclosureUrl      sql.NullString
+	EnclosureType     sql.NullString
+	EnclosureLength   sql.NullInt64
+	Read              bool
+	Starred           bool
+}
+
+// The post columns are listed rather than embedded to leave search_vector,
+// which is only used for matching, out of the results.
+func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams) ([]GetPostsForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, getPostsForUser,
+		arg.UserID,
+		arg.UnreadOnly,
+		arg.StarredOnly,
+		arg.FeedID,
+		arg.FolderID,
+		arg.PublishedSince,
+		arg.PublishedUntil,
+		arg.TitlePattern,
+		arg.CursorPublishedAt,
+		arg.CursorID,
+		arg.MaxPosts,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetPostsForUserRow
+	for rows.Next() {
+		var i GetPostsForUserRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Title,
+			&i.Description,
+			&i.PublishedAt,
+			&i.Url,
+			&i.FeedID,
+			&i.PublishedAtSource,
+			&i.ItemKey,
+			&i.Guid,
+			&i.Author,
+			pq.Array(&i.Categories),
+			&i.Content,
+			&i.EnclosureUrl,
+			&i.EnclosureType,
+			&i.EnclosureLength,
+			&i.Read,
+			&i.Starred,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRecentPostDatesForFeed = `-- name: GetRecentPostDatesForFeed :many
+SELECT published_at FROM posts
+WHERE feed_id = $1
+ORDER BY published_at DESC
+LIMIT $2
+`
+
+type GetRecentPostDatesForFeedParams struct {
+	FeedID uuid.UUID
 	Limit  int32
 }
 
-func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams) ([]Post, error) {
-	rows, err := q.db.QueryContext(ctx, getPostsForUser, arg.UserID, arg.Limit)
+func (q *Queries) GetRecentPostDatesForFeed(ctx context.Context, arg GetRecentPostDatesForFeedParams) ([]time.Time, error) {
+	rows, err := q.db.QueryContext(ctx, getRecentPostDatesForFeed, arg.FeedID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []time.Time
+	for rows.Next() {
+		var published_at time.Time
+		if err := rows.Scan(&published_at); err != nil {
+			return nil, err
+		}
+		items = append(items, published_at)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const rekeyLegacyPost = `-- name: RekeyLegacyPost :execrows
+UPDATE posts SET item_key = $1
+WHERE feed_id = $2
+    AND item_key = $3
+    AND guid IS NULL
+    AND NOT EXISTS (
+        SELECT 1 FROM posts existing
+        WHERE existing.feed_id = $2 AND existing.item_key = $1
+    )
+`
+
+type RekeyLegacyPostParams struct {
+	ItemKey string
+	FeedID  uuid.UUID
+	Url     string
+}
+
+// Posts stored before item keys existed are keyed on their link. Once
+// their item is seen with a GUID, the post takes the GUID as its key
+// rather than being inserted again.
+func (q *Queries) RekeyLegacyPost(ctx context.Context, arg RekeyLegacyPostParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, rekeyLegacyPost, arg.ItemKey, arg.FeedID, arg.Url)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const searchPostsForUser = `-- name: SearchPostsForUser :many
+SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.description, posts.published_at, posts.url, posts.feed_id, posts.published_at_source, posts.item_key, posts.guid, posts.author, posts.categories, posts.content, posts.enclosure_url, posts.enclosure_type, posts.enclosure_length,
+    EXISTS (
+        SELECT 1 FROM post_reads
+        WHERE post_reads.post_id = posts.id AND post_reads.user_id = feed_follows.user_id
+    )::bool AS read,
+    EXISTS (
+        SELECT 1 FROM post_stars
+        WHERE post_stars.post_id = posts.id AND post_stars.user_id = feed_follows.user_id
+    )::bool AS starred,
+    ts_rank(posts.search_vector, query)::real AS rank,
+    ts_headline(
+        'english',
+        coalesce(posts.content, posts.description, posts.title),
+        query,
+        'StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=30, MinWords=10'
+    )::text AS headline
+FROM posts
+JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
+CROSS JOIN websearch_to_tsquery('english', $1) query
+WHERE feed_follows.user_id = $2
+    AND posts.search_vector @@ query
+ORDER BY rank DESC, posts.published_at DESC
+LIMIT $3
+`
+
+type SearchPostsForUserParams struct {
+	Query    string
+	UserID   uuid.UUID
+	MaxPosts int32
+}
+
+type SearchPostsForUserRow struct {
+	ID                uuid.UUID
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	Title             string
+	Description       sql.NullString
+	PublishedAt       time.Time
+	Url               string
+	FeedID            uuid.UUID
+	PublishedAtSource string
+	ItemKey           string
+	Guid              sql.NullString
+	Author            sql.NullString
+	Categories        []string
+	Content           sql.NullString
+	EnclosureUrl      sql.NullString
+	EnclosureType     sql.NullString
+	EnclosureLength   sql.NullInt64
+	Read              bool
+	Starred           bool
+	Rank              float32
+	Headline          string
+}
+
+func (q *Queries) SearchPostsForUser(ctx context.Context, arg SearchPostsForUserParams) ([]SearchPostsForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchPostsForUser, arg.Query, arg.UserID, arg.MaxPosts)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Post
+	var items []SearchPostsForUserRow
 	for rows.Next() {
-		var i Post
+		var i SearchPostsForUserRow
 		if err := rows.Scan(
 			&i.ID,
 			&i.CreatedAt,
@@ -95,6 +345,19 @@ func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams
 			&i.PublishedAt,
 			&i.Url,
 			&i.FeedID,
+			&i.PublishedAtSource,
+			&i.ItemKey,
+			&i.Guid,
+			&i.Author,
+			pq.Array(&i.Categories),
+			&i.Content,
+			&i.EnclosureUrl,
+			&i.EnclosureType,
+			&i.EnclosureLength,
+			&i.Read,
+			&i.Starred,
+			&i.Rank,
+			&i.Headline,
 		); err != nil {
 			return nil, err
 		}
@@ -108,3 +371,113 @@ func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams
 	}
 	return items, nil
 }
+
+const upsertPost = `-- name: UpsertPost :one
+INSERT INTO posts(
+    id,
+    created_at,
+    updated_at,
+    title,
+    description,
+    published_at,
+    url,
+    feed_id,
+    published_at_source,
+    item_key,
+    guid,
+    author,
+    categories,
+    content,
+    enclosure_url,
+    enclosure_type,
+    enclosure_length)
+values($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17
+)
+ON CONFLICT (feed_id, item_key) DO UPDATE
+SET title = EXCLUDED.title,
+    description = EXCLUDED.description,
+    url = EXCLUDED.url,
+    published_at = CASE
+        WHEN EXCLUDED.published_at_source = 'item' THEN EXCLUDED.published_at
+        ELSE posts.published_at
+    END,
+    published_at_source = CASE
+        WHEN EXCLUDED.published_at_source = 'item' THEN EXCLUDED.published_at_source
+        ELSE posts.published_at_source
+    END,
+    guid = EXCLUDED.guid,
+    author = EXCLUDED.author,
+    categories = EXCLUDED.categories,
+    content = EXCLUDED.content,
+    enclosure_url = EXCLUDED.enclosure_url,
+    enclosure_type = EXCLUDED.enclosure_type,
+    enclosure_length = EXCLUDED.enclosure_length,
+    updated_at = EXCLUDED.updated_at
+WHERE (
+    posts.title, posts.description, posts.url, posts.guid, posts.author, posts.categories,
+    posts.content, posts.enclosure_url, posts.enclosure_type, posts.enclosure_length
+) IS DISTINCT FROM (
+    EXCLUDED.title, EXCLUDED.description, EXCLUDED.url, EXCLUDED.guid, EXCLUDED.author, EXCLUDED.categories,
+    EXCLUDED.content, EXCLUDED.enclosure_url, EXCLUDED.enclosure_type, EXCLUDED.enclosure_length
+) OR (
+    EXCLUDED.published_at_source = 'item'
+    AND (posts.published_at, posts.published_at_source)
+        IS DISTINCT FROM (EXCLUDED.published_at, EXCLUDED.published_at_source)
+)
+RETURNING id, (xmax = 0)::bool AS inserted
+`
+
+type UpsertPostParams struct {
+	ID                uuid.UUID
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	Title             string
+	Description       sql.NullString
+	PublishedAt       time.Time
+	Url               string
+	FeedID            uuid.UUID
+	PublishedAtSource string
+	ItemKey           string
+	Guid              sql.NullString
+	Author            sql.NullString
+	Categories        []string
+	Content           sql.NullString
+	EnclosureUrl      sql.NullString
+	EnclosureType     sql.NullString
+	EnclosureLength   sql.NullInt64
+}
+
+type UpsertPostRow struct {
+	ID       uuid.UUID
+	Inserted bool
+}
+
+// Inserts a new item or updates an existing one whose content changed.
+// No row is returned when the stored item is unchanged.
+func (q *Queries) UpsertPost(ctx context.Context, arg UpsertPostParams) (UpsertPostRow, error) {
+	row := q.db.QueryRowContext(ctx, upsertPost,
+		arg.ID,
+		arg.CreatedAt,
+		arg.UpdatedAt,
+		arg.Title,
+		arg.Description,
+		arg.PublishedAt,
+		arg.Url,
+		arg.FeedID,
+		arg.PublishedAtSource,
+		arg.ItemKey,
+		arg.Guid,
+		arg.Author,
+		pq.Array(arg.Categories),
+		arg.Content,
+		arg.EnclosureUrl,
+		arg.EnclosureType,
+		arg.EnclosureLength,
+	)
+	var i UpsertPostRow
+	err := row.Scan(
+		&i.ID,
+		&i.Inserted,
+	)
+	return i, err
+}
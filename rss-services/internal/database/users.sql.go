@@ -13,11 +13,9 @@ import (
 )
 
 const createUser = `-- name: CreateUser :one
-INSERT INTO users(id, created_at, updated_at, name, api_key)
-values($1, $2, $3, $4,
-    encode(sha256(random()::text::bytea), 'hex')
-)
-RETURNING id, created_at, updated_at, name, api_key
+INSERT INTO users(id, created_at, updated_at, name)
+values($1, $2, $3, $4)
+RETURNING id, created_at, updated_at, name
 `
 
 type CreateUserParams struct {
@@ -40,24 +38,6 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Name,
-		&i.ApiKey,
-	)
-	return i, err
-}
-
-const getUserByAPIKey = `-- name: GetUserByAPIKey :one
-SELECT id, created_at, updated_at, name, api_key FROM users WHERE api_key = $1
-`
-
-func (q *Queries) GetUserByAPIKey(ctx context.Context, apiKey string) (User, error) {
-	row := q.db.QueryRowContext(ctx, getUserByAPIKey, apiKey)
-	var i User
-	err := row.Scan(
-		&i.ID,
-		&i.CreatedAt,
-		&i.UpdatedAt,
-		&i.Name,
-		&i.ApiKey,
 	)
 	return i, err
 }
@@ -0,0 +1,119 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// One token per second, three at once
+var testLimit = Limit{Requests: 60, Per: time.Minute, Burst: 3}
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestStore() (*MemoryStore, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	store := NewMemoryStore()
+	store.now = clock.Now
+
+	return store, clock
+}
+
+func take(t *testing.T, store *MemoryStore, key string) Result {
+	t.Helper()
+
+	result, err := store.Take(context.Background(), key, testLimit)
+	if err != nil {
+		t.Fatalf("Take() error = %v", err)
+	}
+
+	return result
+}
+
+func TestMemoryStoreTake(t *testing.T) {
+	store, clock := newTestStore()
+
+	type step struct {
+		advance time.Duration
+		want    Result
+	}
+
+	steps := []step{
+		{want: Result{Allowed: true, Limit: 3, Remaining: 2, ResetAfter: time.Second}},
+		{want: Result{Allowed: true, Limit: 3, Remaining: 1, ResetAfter: 2 * time.Second}},
+		{want: Result{Allowed: true, Limit: 3, Remaining: 0, ResetAfter: 3 * time.Second}},
+		// Empty bucket, the next token is a second away
+		{want: Result{Allowed: false, Limit: 3, Remaining: 0, ResetAfter: 3 * time.Second, RetryAfter: time.Second}},
+		{
+			advance: 500 * time.Millisecond,
+			want:    Result{Allowed: false, Limit: 3, Remaining: 0, ResetAfter: 2500 * time.Millisecond, RetryAfter: 500 * time.Millisecond},
+		},
+		// Refilled one token, which is taken right away
+		{
+			advance: 500 * time.Millisecond,
+			want:    Result{Allowed: true, Limit: 3, Remaining: 0, ResetAfter: 3 * time.Second},
+		},
+		// Refilling stops at the burst
+		{
+			advance: time.Hour,
+			want:    Result{Allowed: true, Limit: 3, Remaining: 2, ResetAfter: time.Second},
+		},
+	}
+
+	for i, step := range steps {
+		clock.Advance(step.advance)
+
+		if got := take(t, store, "client"); got != step.want {
+			t.Errorf("step %d: Take() = %+v, want %+v", i, got, step.want)
+		}
+	}
+}
+
+func TestMemoryStoreKeysAreIndependent(t *testing.T) {
+	store, _ := newTestStore()
+
+	for range testLimit.Burst {
+		take(t, store, "a")
+	}
+
+	if result := take(t, store, "a"); result.Allowed {
+		t.Errorf("Take(a) allowed past the burst")
+	}
+
+	if result := take(t, store, "b"); !result.Allowed || result.Remaining != 2 {
+		t.Errorf("Take(b) = %+v, want a fresh bucket", result)
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	store, clock := newTestStore()
+
+	take(t, store, "idle")
+
+	clock.Advance(memorySweepInterval - time.Second)
+	for range testLimit.Burst {
+		take(t, store, "busy")
+	}
+
+	// Sweeps on the way, idle is full again while busy isn't
+	clock.Advance(time.Second)
+	take(t, store, "busy")
+
+	if _, ok := store.buckets["idle"]; ok {
+		t.Error("refilled bucket was not swept")
+	}
+	if _, ok := store.buckets["busy"]; !ok {
+		t.Error("bucket in use was swept")
+	}
+}
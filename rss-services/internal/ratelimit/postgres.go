@@ -0,0 +1,83 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/hoang-cao-long/golang-side-projects/rss-services/internal/database"
+)
+
+const (
+	// How often buckets unused for postgresStaleAfter are deleted
+	postgresSweepInterval = 10 * time.Minute
+	postgresStaleAfter    = 24 * time.Hour
+)
+
+// PostgresStore keeps buckets in the rate_limit_buckets table, so every
+// replica shares the same limits. Tokens are taken in a single statement
+// and timed with the database clock.
+type PostgresStore struct {
+	db *database.Queries
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+func NewPostgresStore(db *database.Queries) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	s.sweep()
+
+	tokens, err := s.db.TakeRateLimitToken(ctx, database.TakeRateLimitTokenParams{
+		Key:   key,
+		Burst: float64(limit.Burst),
+		Rate:  limit.Rate(),
+	})
+
+	if err == nil {
+		return newResult(limit, tokens, true), nil
+	}
+
+	if !errors.Is(err, sql.ErrNoRows) {
+		return Result{}, err
+	}
+
+	// The bucket was empty, read it to tell when the next token comes
+	tokens, err = s.db.GetRateLimitTokens(ctx, database.GetRateLimitTokensParams{
+		Burst: float64(limit.Burst),
+		Rate:  limit.Rate(),
+		Key:   key,
+	})
+
+	if err != nil {
+		return Result{}, err
+	}
+
+	return newResult(limit, tokens, false), nil
+}
+
+// sweep deletes stale buckets in the background, at most once per
+// postgresSweepInterval for each replica
+func (s *PostgresStore) sweep() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if time.Since(s.lastSweep) < postgresSweepInterval {
+		return
+	}
+	s.lastSweep = time.Now()
+
+	go func() {
+		_, err := s.db.DeleteStaleRateLimitBuckets(context.Background(), int32(postgresStaleAfter/time.Second))
+
+		if err != nil {
+			slog.Error("Error deleting stale rate limit buckets", "error", err)
+		}
+	}()
+}
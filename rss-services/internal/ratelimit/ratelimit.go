@@ -0,0 +1,66 @@
+// Package ratelimit implements token bucket rate limiting with pluggable
+// storage, so limits can be kept per process or shared between replicas.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Limit allows Burst requests at once, refilled at Requests per Per
+type Limit struct {
+	Requests int
+	Per      time.Duration
+	Burst    int
+}
+
+// Rate is how many tokens are added to a bucket per second
+func (l Limit) Rate() float64 {
+	return float64(l.Requests) / l.Per.Seconds()
+}
+
+// Result is the state of a bucket after taking a token from it
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// ResetAfter is how long until the bucket is full again
+	ResetAfter time.Duration
+	// RetryAfter is how long until the next token, zero when allowed
+	RetryAfter time.Duration
+}
+
+// Store keeps buckets. Take removes one token from the bucket of key if
+// it has one, refilling it for the time passed since it was last used.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// newResult builds the Result of a bucket holding tokens once the
+// token, if any, has been taken
+func newResult(limit Limit, tokens float64, allowed bool) Result {
+	rate := limit.Rate()
+
+	result := Result{
+		Allowed:    allowed,
+		Limit:      limit.Burst,
+		Remaining:  int(math.Floor(max(tokens, 0))),
+		ResetAfter: secondsToDuration((float64(limit.Burst) - tokens) / rate),
+	}
+
+	if !allowed {
+		result.RetryAfter = secondsToDuration((1 - tokens) / rate)
+	}
+
+	return result
+}
+
+// refill returns the tokens of a bucket after elapsed time, capped at burst
+func refill(limit Limit, tokens float64, elapsed time.Duration) float64 {
+	return min(float64(limit.Burst), tokens+max(elapsed.Seconds(), 0)*limit.Rate())
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(max(seconds, 0) * float64(time.Second))
+}
@@ -2,28 +2,44 @@ package main
 
 import (
 	"encoding/json"
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
 )
 
-func respondWithError(w http.ResponseWriter, code int, msg string) {
-	if code > 499 {
-		log.Println("Responding with 5xx error:", msg)
+// respondWithError writes err as a JSON error body. Errors that are not an
+// appError are treated as internal errors and their text is only logged.
+func respondWithError(w http.ResponseWriter, r *http.Request, err error) {
+	appErr := &appError{}
+	if !errors.As(err, &appErr) {
+		appErr = errInternal(err)
+	}
+
+	requestID := requestIDFromContext(r.Context())
+
+	if appErr.Status > 499 {
+		slog.ErrorContext(r.Context(), "Responding with 5xx error", "status", appErr.Status, "error", appErr)
 	}
 
 	type errResponse struct {
-		Error string `json:"error"`
+		Error     string       `json:"error"`
+		Code      string       `json:"code"`
+		RequestID string       `json:"request_id,omitempty"`
+		Fields    []FieldError `json:"fields,omitempty"`
 	}
 
-	respondWithJSON(w, code, errResponse{
-		Error: msg,
+	respondWithJSON(w, appErr.Status, errResponse{
+		Error:     appErr.Message,
+		Code:      appErr.Code,
+		RequestID: requestID,
+		Fields:    appErr.Fields,
 	})
 }
 
 func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	dat, err := json.Marshal(payload)
 	if err != nil {
-		log.Printf("Failed to marshal JSON response: %v", payload)
+		slog.Error("Failed to marshal JSON response", "payload", payload, "error", err)
 		w.WriteHeader(500)
 		return
 	}
@@ -1,23 +1,52 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"log"
+	"log/slog"
 	"net/http"
+	"net/netip"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/cors"
 	"github.com/hoang-cao-long/golang-side-projects/rss-services/internal/database"
+	"github.com/hoang-cao-long/golang-side-projects/rss-services/internal/ratelimit"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 type apiConfig struct {
 	DB *database.Queries
+	// DBConn is used to start transactions, see newQueries
+	DBConn     *sql.DB
+	RateLimits ratelimit.Store
+	Scraper    *scraperStatus
+	// Proxies whose X-Forwarded-For header is used to find client IPs
+	TrustedProxies []netip.Prefix
 }
 
+// How long in-flight requests and scrapes get to finish on shutdown
+const shutdownTimeout = 30 * time.Second
+
+const scrapeInterval = time.Minute
+
+// Rate limits of the route groups
+var (
+	signupRateLimit = ratelimit.Limit{Requests: 5, Per: time.Hour, Burst: 5}
+	// Routes that fetch remote feeds or write many rows
+	heavyRateLimit   = ratelimit.Limit{Requests: 30, Per: time.Minute, Burst: 10}
+	defaultRateLimit = ratelimit.Limit{Requests: 300, Per: time.Minute, Burst: 60}
+)
+
 func main() {
 	// feed, err := urlToFeed("https://wagslane.dev/index.xml")
 
@@ -29,64 +58,182 @@ func main() {
 
 	godotenv.Load(".env")
 
+	logger, err := newLogger(os.Stdout, os.Getenv("LOG_LEVEL"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Also routes the log package, used by dependencies, through slog
+	slog.SetDefault(logger)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := setupTracing(ctx)
+	if err != nil {
+		slog.Error("Can't set up tracing", "error", err)
+		os.Exit(1)
+	}
+
 	portString := os.Getenv("PORT")
 	if portString == "" {
-		log.Fatal("PORT is not found in the environment")
+		slog.Error("PORT is not found in the environment")
+		os.Exit(1)
 	}
 
 	dbUrl := os.Getenv("DB_URL_POSTGRES")
 	if dbUrl == "" {
-		log.Fatal("DB_URL_POSTGRES is not found in the environment")
+		slog.Error("DB_URL_POSTGRES is not found in the environment")
+		os.Exit(1)
 	}
 
 	conn, err := sql.Open("postgres", dbUrl)
 	if err != nil {
-		log.Fatal("Can't connect to the database", err)
+		slog.Error("Can't connect to the database", "error", err)
+		os.Exit(1)
 	}
+	prometheus.MustRegister(collectors.NewDBStatsCollector(conn, "rss"))
 
 	apiConfig := apiConfig{
-		DB: database.New(conn),
+		DB:         newQueries(conn),
+		DBConn:     conn,
+		RateLimits: ratelimit.NewMemoryStore(),
+		Scraper:    newScraperStatus(scrapeInterval),
 	}
 
-	go startScraping(apiConfig.DB, 10, time.Minute)
+	apiConfig.TrustedProxies, err = parseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		slog.Error("Can't parse TRUSTED_PROXIES", "error", err)
+		os.Exit(1)
+	}
+
+	// Replicas only share limits when they are kept in Postgres
+	if os.Getenv("RATE_LIMIT_STORE") == "postgres" {
+		apiConfig.RateLimits = ratelimit.NewPostgresStore(apiConfig.DB)
+	}
+
+	scraperDone := make(chan struct{})
+	go func() {
+		defer close(scraperDone)
+		startScraping(ctx, apiConfig.DB, apiConfig.Scraper, 10, scrapeInterval)
+	}()
 
 	router := chi.NewRouter()
 
+	router.Use(middlewareTracing)
+	router.Use(middlewareRequestID)
+	router.Use(middlewareLogging)
+	router.Use(middlewareMetrics)
 	router.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"https://*", "http://*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"*"},
-		ExposedHeaders:   []string{"Link"},
+		ExposedHeaders:   []string{"Link", requestIDHeader, "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After"},
 		AllowCredentials: false,
 		MaxAge:           300,
 	}))
 
 	v1Router := chi.NewRouter()
-	v1Router.Get("/caolong", handleReadliness)
+	// Kept for clients from before /healthz
+	v1Router.Get("/caolong", handleHealthz)
 	v1Router.Get("/err", handleErr)
 
-	v1Router.Post("/users", apiConfig.handleCreateUser)
-	v1Router.Get("/users", apiConfig.middlewareAuth(apiConfig.handleGetUser))
+	v1Router.Group(func(r chi.Router) {
+		r.Use(apiConfig.middlewareRateLimit("signup", signupRateLimit, rateLimitByIP))
+
+		r.Post("/users", apiConfig.handleCreateUser)
+	})
+
+	v1Router.Group(func(r chi.Router) {
+		r.Use(apiConfig.middlewareRateLimit("heavy", heavyRateLimit, rateLimitByKeyOrIP))
 
-	v1Router.Post("/feeds", apiConfig.middlewareAuth(apiConfig.handleCreateFeed))
-	v1Router.Get("/feeds", apiConfig.handleGetFeed)
+		r.Post("/api_keys", apiConfig.middlewareAuth(apiConfig.handleCreateAPIKey))
+		r.Post("/feeds", apiConfig.middlewareAuth(apiConfig.handleCreateFeed))
+		r.Get("/feeds/discover", apiConfig.middlewareAuth(apiConfig.handleDiscoverFeeds))
+		r.Post("/opml", apiConfig.middlewareAuth(apiConfig.handleImportOPML))
+	})
 
-	v1Router.Get("/posts", apiConfig.middlewareAuth(apiConfig.handleGetPostsForUser))
+	v1Router.Group(func(r chi.Router) {
+		r.Use(apiConfig.middlewareRateLimit("default", defaultRateLimit, rateLimitByKeyOrIP))
 
-	v1Router.Post("/feed_follows", apiConfig.middlewareAuth(apiConfig.handleCreateFeedFollow))
-	v1Router.Get("/feed_follows", apiConfig.middlewareAuth(apiConfig.handleGetFeedFollows))
-	v1Router.Delete("/feed_follows/{feedFollowID}", apiConfig.middlewareAuth(apiConfig.handleDeleteFeedFollow))
+		r.Get("/users", apiConfig.middlewareAuth(apiConfig.handleGetUser))
+
+		r.Get("/api_keys", apiConfig.middlewareAuth(apiConfig.handleGetAPIKeys))
+		r.Delete("/api_keys/{apiKeyID}", apiConfig.middlewareAuth(apiConfig.handleDeleteAPIKey))
+
+		r.Get("/feeds", apiConfig.handleGetFeed)
+		r.Get("/feeds/unhealthy", apiConfig.middlewareAuth(apiConfig.handleGetUnhealthyFeeds))
+		r.Post("/feeds/{feedID}/enable", apiConfig.middlewareAuth(apiConfig.handleEnableFeed))
+
+		r.Get("/posts", apiConfig.middlewareAuth(apiConfig.handleGetPostsForUser))
+		r.Get("/posts/search", apiConfig.middlewareAuth(apiConfig.handleSearchPosts))
+		r.Post("/posts/read", apiConfig.middlewareAuth(apiConfig.handleMarkFeedPostsRead))
+		r.Post("/posts/{postID}/read", apiConfig.middlewareAuth(apiConfig.handleMarkPostRead))
+		r.Delete("/posts/{postID}/read", apiConfig.middlewareAuth(apiConfig.handleMarkPostUnread))
+		r.Post("/posts/{postID}/star", apiConfig.middlewareAuth(apiConfig.handleStarPost))
+		r.Delete("/posts/{postID}/star", apiConfig.middlewareAuth(apiConfig.handleUnstarPost))
+
+		r.Get("/opml", apiConfig.middlewareAuth(apiConfig.handleExportOPML))
+
+		r.Post("/folders", apiConfig.middlewareAuth(apiConfig.handleCreateFolder))
+		r.Get("/folders", apiConfig.middlewareAuth(apiConfig.handleGetFolders))
+		r.Put("/folders/{folderID}", apiConfig.middlewareAuth(apiConfig.handleUpdateFolder))
+		r.Delete("/folders/{folderID}", apiConfig.middlewareAuth(apiConfig.handleDeleteFolder))
+
+		r.Post("/feed_follows", apiConfig.middlewareAuth(apiConfig.handleCreateFeedFollow))
+		r.Get("/feed_follows", apiConfig.middlewareAuth(apiConfig.handleGetFeedFollows))
+		r.Patch("/feed_follows/{feedFollowID}", apiConfig.middlewareAuth(apiConfig.handleUpdateFeedFollow))
+		r.Delete("/feed_follows/{feedFollowID}", apiConfig.middlewareAuth(apiConfig.handleDeleteFeedFollow))
+	})
 
 	router.Mount("/v1", v1Router)
+	router.Handle("/metrics", promhttp.Handler())
+	router.Get("/healthz", handleHealthz)
+	router.Get("/readyz", apiConfig.handleReadyz)
 
 	srv := &http.Server{
 		Handler: router,
 		Addr:    ":" + portString,
 	}
 
-	log.Printf("Server starting on port %v", portString)
-	err = srv.ListenAndServe()
-	if err != nil {
-		log.Fatal(err)
+	serverErr := make(chan error, 1)
+	go func() {
+		slog.Info("Server starting", "port", portString)
+		serverErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Server failed", "error", err)
+			os.Exit(1)
+		}
+	case <-ctx.Done():
+		slog.Info("Shutdown signal received, draining")
 	}
+
+	// Restore default signal handling so a second signal exits right away
+	stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Error shutting down server", "error", err)
+	}
+
+	select {
+	case <-scraperDone:
+	case <-shutdownCtx.Done():
+		slog.Warn("Scraper did not stop before the shutdown timeout")
+	}
+
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Error("Error flushing traces", "error", err)
+	}
+
+	if err := conn.Close(); err != nil {
+		slog.Error("Error closing database", "error", err)
+	}
+
+	slog.Info("Server stopped")
 }
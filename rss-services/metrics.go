@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/hoang-cao-long/golang-side-projects/rss-services/internal/database"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	httpRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rss_http_requests_total",
+		Help: "HTTP requests by method, route pattern and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "rss_http_request_duration_seconds",
+		Help:    "HTTP request latency by method and route pattern.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	feedFetchesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rss_feed_fetches_total",
+		Help: "Feed fetches by HTTP status code, \"error\" when no response was received.",
+	}, []string{"status"})
+
+	feedFetchDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "rss_feed_fetch_duration_seconds",
+		Help:    "Time to fetch and parse a feed.",
+		Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	})
+
+	feedFetchBytes = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "rss_feed_fetch_bytes",
+		Help:    "Size of fetched feed bodies.",
+		Buckets: prometheus.ExponentialBuckets(1024, 4, 8),
+	})
+
+	feedParseFailuresTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "rss_feed_parse_failures_total",
+		Help: "Fetched feeds whose body could not be parsed.",
+	})
+
+	// One series per feed and result, so the number of series grows with
+	// the number of feeds
+	postsUpsertedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rss_posts_upserted_total",
+		Help: "Scraped posts by feed and result: new, updated, unchanged, failed or skipped. The feed_id label makes one series per feed.",
+	}, []string{"feed_id", "result"})
+
+	scraperQueueLag = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "rss_scraper_queue_lag_seconds",
+		Help: "Time since the longest waiting due feed became due, 0 when no feed is due.",
+	})
+)
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// middlewareMetrics counts requests and their latency. Routes are labelled
+// with their chi pattern, e.g. /v1/posts/{postID}/read, to keep the
+// number of series bounded.
+func middlewareMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(recorder, r)
+
+		route := "unmatched"
+		if routeCtx := chi.RouteContext(r.Context()); routeCtx != nil && routeCtx.RoutePattern() != "" {
+			route = routeCtx.RoutePattern()
+		}
+
+		httpRequestsTotal.WithLabelValues(r.Method, route, strconv.Itoa(recorder.status)).Inc()
+		httpRequestDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
+
+func observeFeedFetch(fetch feedFetch, err error, duration time.Duration) {
+	status := "error"
+	if fetch.StatusCode != 0 {
+		status = strconv.Itoa(fetch.StatusCode)
+	}
+
+	feedFetchesTotal.WithLabelValues(status).Inc()
+	feedFetchDuration.Observe(duration.Seconds())
+
+	if fetch.Size > 0 {
+		feedFetchBytes.Observe(float64(fetch.Size))
+	}
+
+	if errors.Is(err, errFeedParse) {
+		feedParseFailuresTotal.Inc()
+	}
+}
+
+func updateScraperQueueLag(ctx context.Context, db *database.Queries) {
+	lag, err := db.GetScraperQueueLag(ctx)
+
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.ErrorContext(ctx, "Error getting scraper queue lag", "error", err)
+		}
+		return
+	}
+
+	scraperQueueLag.Set(max(lag, 0))
+}
@@ -1,8 +1,13 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/hoang-cao-long/golang-side-projects/rss-services/internal/auth"
 	"github.com/hoang-cao-long/golang-side-projects/rss-services/internal/database"
@@ -10,22 +15,72 @@ import (
 
 type authedHandler func(http.ResponseWriter, *http.Request, database.User)
 
+type authResultKey struct{}
+
+// authResult is the outcome of resolving the API key of a request
+type authResult struct {
+	row database.GetAPIKeyByHashRow
+	err error
+}
+
 func (apiConfig *apiConfig) middlewareAuth(handler authedHandler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		apiKey, err := auth.GetAPIkey(r.Header)
+		r, row, err := apiConfig.authenticate(r)
 
 		if err != nil {
-			respondWithError(w, 403, fmt.Sprintf("Auth error: %v", err))
+			respondWithError(w, r, err)
 			return
 		}
 
-		user, err := apiConfig.DB.GetUserByAPIKey(r.Context(), apiKey)
+		err = apiConfig.DB.TouchAPIKey(r.Context(), row.ApiKey.ID)
 
 		if err != nil {
-			respondWithError(w, 400, fmt.Sprintf("Couldn't get user: %v", err))
-			return
+			slog.ErrorContext(r.Context(), "Error updating API key last use", "error", err)
 		}
 
-		handler(w, r, user)
+		handler(w, r, row.User)
+	}
+}
+
+// authenticate resolves the API key of r to its user. The result is kept
+// in the returned request, so the rate limiter and middlewareAuth only
+// look the key up once.
+func (apiConfig *apiConfig) authenticate(r *http.Request) (*http.Request, database.GetAPIKeyByHashRow, error) {
+	if result, ok := r.Context().Value(authResultKey{}).(authResult); ok {
+		return r, result.row, result.err
+	}
+
+	row, err := apiConfig.lookupAPIKey(r)
+
+	ctx := context.WithValue(r.Context(), authResultKey{}, authResult{row: row, err: err})
+	if err == nil {
+		// Handlers and their queries log which user they act for
+		ctx = withLogAttrs(ctx, slog.String("user_id", row.User.ID.String()))
 	}
+
+	return r.WithContext(ctx), row, err
+}
+
+func (apiConfig *apiConfig) lookupAPIKey(r *http.Request) (database.GetAPIKeyByHashRow, error) {
+	apiKey, err := auth.GetAPIkey(r.Header)
+
+	if err != nil {
+		return database.GetAPIKeyByHashRow{}, errUnauthorized(fmt.Sprintf("Auth error: %v", err))
+	}
+
+	row, err := apiConfig.DB.GetAPIKeyByHash(r.Context(), auth.HashAPIKey(apiKey))
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.GetAPIKeyByHashRow{}, errUnauthorized("Invalid API key")
+	}
+
+	if err != nil {
+		return database.GetAPIKeyByHashRow{}, dbError(err, "API key")
+	}
+
+	if row.ApiKey.ExpiresAt.Valid && !row.ApiKey.ExpiresAt.Time.After(time.Now().UTC()) {
+		return database.GetAPIKeyByHashRow{}, errUnauthorized("API key expired")
+	}
+
+	return row, nil
 }
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hoang-cao-long/golang-side-projects/rss-services/internal/database"
+	"github.com/hoang-cao-long/golang-side-projects/rss-services/internal/ratelimit"
+)
+
+// rateLimitScope decides who a rate limit bucket belongs to
+type rateLimitScope int
+
+const (
+	// Per client IP, whatever the request authenticates as
+	rateLimitByIP rateLimitScope = iota
+	// Per API key for requests with a valid key, per client IP otherwise
+	rateLimitByKeyOrIP
+)
+
+// middlewareRateLimit limits the requests to a group of routes, each group
+// has its own buckets
+func (apiConfig *apiConfig) middlewareRateLimit(group string, limit ratelimit.Limit, scope rateLimitScope) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r, key := apiConfig.rateLimitKey(r, scope)
+
+			result, err := apiConfig.RateLimits.Take(r.Context(), group+":"+key, limit)
+
+			if err != nil {
+				// Better to serve unlimited than to fail every request
+				slog.ErrorContext(r.Context(), "Error taking rate limit token", "group", group, "error", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			w.Header().Set("RateLimit-Reset", ceilSeconds(result.ResetAfter))
+
+			if !result.Allowed {
+				w.Header().Set("Retry-After", ceilSeconds(result.RetryAfter))
+				respondWithError(w, r, errTooManyRequests("Rate limit exceeded"))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// rateLimitKey identifies who is making a request. Only keys that resolve
+// to a user get a bucket of their own, otherwise sending a new random key
+// with every request would get a full bucket each time.
+func (apiConfig *apiConfig) rateLimitKey(r *http.Request, scope rateLimitScope) (*http.Request, string) {
+	if scope == rateLimitByKeyOrIP && r.Header.Get("Authorization") != "" {
+		var row database.GetAPIKeyByHashRow
+		var err error
+
+		r, row, err = apiConfig.authenticate(r)
+		if err == nil {
+			return r, "key:" + row.ApiKey.ID.String()
+		}
+	}
+
+	return r, "ip:" + clientIP(r, apiConfig.TrustedProxies)
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
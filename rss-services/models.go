@@ -1,6 +1,7 @@
 package main
 
 import (
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
@@ -12,7 +13,6 @@ type User struct {
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 	Name      string    `json:"name"`
-	ApiKey    string    `json:"api_key"`
 }
 
 func databaseUserToUser(dbUser database.User) User {
@@ -21,27 +21,67 @@ func databaseUserToUser(dbUser database.User) User {
 		CreatedAt: dbUser.CreatedAt,
 		UpdatedAt: dbUser.UpdatedAt,
 		Name:      dbUser.Name,
-		ApiKey:    dbUser.ApiKey,
 	}
 }
 
+type APIKey struct {
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+}
+
+// CreatedAPIKey is only returned when a key is minted, it is the one
+// time the key itself is shown
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+func databaseAPIKeyToAPIKey(dbAPIKey database.ApiKey) APIKey {
+	return APIKey{
+		ID:         dbAPIKey.ID,
+		CreatedAt:  dbAPIKey.CreatedAt,
+		Name:       dbAPIKey.Name,
+		Prefix:     dbAPIKey.Prefix,
+		LastUsedAt: nullTimeToTimePtr(dbAPIKey.LastUsedAt),
+		ExpiresAt:  nullTimeToTimePtr(dbAPIKey.ExpiresAt),
+	}
+}
+
+func databaseAPIKeysToAPIKeys(dbAPIKeys []database.ApiKey) []APIKey {
+	apiKeys := []APIKey{}
+
+	for _, dbAPIKey := range dbAPIKeys {
+		apiKeys = append(apiKeys, databaseAPIKeyToAPIKey(dbAPIKey))
+	}
+
+	return apiKeys
+}
+
 type Feed struct {
-	ID        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Name      string    `json:"name"`
-	Url       string    `json:"url"`
-	UserID    uuid.UUID `json:"user_id"`
+	ID            uuid.UUID  `json:"id"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	Name          string     `json:"name"`
+	Url           string     `json:"url"`
+	UserID        uuid.UUID  `json:"user_id"`
+	Active        bool       `json:"active"`
+	LastFetchedAt *time.Time `json:"last_fetched_at"`
 }
 
 func databaseFeedToFeed(dbFeed database.Feed) Feed {
 	return Feed{
-		ID:        dbFeed.ID,
-		CreatedAt: dbFeed.CreatedAt,
-		UpdatedAt: dbFeed.UpdatedAt,
-		Name:      dbFeed.Name,
-		Url:       dbFeed.Url,
-		UserID:    dbFeed.UserID,
+		ID:            dbFeed.ID,
+		CreatedAt:     dbFeed.CreatedAt,
+		UpdatedAt:     dbFeed.UpdatedAt,
+		Name:          dbFeed.Name,
+		Url:           dbFeed.Url,
+		UserID:        dbFeed.UserID,
+		Active:        dbFeed.Active,
+		LastFetchedAt: nullTimeToTimePtr(dbFeed.LastFetchedAt),
 	}
 }
 
@@ -55,12 +95,42 @@ func databaseFeedsToFeeds(dbFeeds []database.Feed) []Feed {
 	return feeds
 }
 
+// FeedHealth adds the fetch errors of a feed, which can leak details of
+// the publisher's setup, so it is only shown to the feed's owner
+type FeedHealth struct {
+	Feed
+	LastSuccessAt       *time.Time `json:"last_success_at"`
+	ConsecutiveFailures int32      `json:"consecutive_failures"`
+	LastError           *string    `json:"last_error"`
+}
+
+func databaseFeedToFeedHealth(dbFeed database.Feed) FeedHealth {
+	return FeedHealth{
+		Feed:                databaseFeedToFeed(dbFeed),
+		LastSuccessAt:       nullTimeToTimePtr(dbFeed.LastSuccessAt),
+		ConsecutiveFailures: dbFeed.ConsecutiveFailures,
+		LastError:           nullStringToStringPtr(dbFeed.LastError),
+	}
+}
+
+func databaseFeedsToFeedHealths(dbFeeds []database.Feed) []FeedHealth {
+	feeds := []FeedHealth{}
+
+	for _, dbFeed := range dbFeeds {
+		feeds = append(feeds, databaseFeedToFeedHealth(dbFeed))
+	}
+
+	return feeds
+}
+
 type FeedFollow struct {
-	ID        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	UserID    uuid.UUID `json:"user_id"`
-	FeedID    uuid.UUID `json:"feed_id"`
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	UserID    uuid.UUID  `json:"user_id"`
+	FeedID    uuid.UUID  `json:"feed_id"`
+	FolderID  *uuid.UUID `json:"folder_id"`
+	Title     *string    `json:"title"`
 }
 
 func databaseFeedFollowToFeedFollow(dbFeedFollow database.FeedFollow) FeedFollow {
@@ -70,6 +140,8 @@ func databaseFeedFollowToFeedFollow(dbFeedFollow database.FeedFollow) FeedFollow
 		UpdatedAt: dbFeedFollow.UpdatedAt,
 		UserID:    dbFeedFollow.UserID,
 		FeedID:    dbFeedFollow.FeedID,
+		FolderID:  nullUUIDToUUIDPtr(dbFeedFollow.FolderID),
+		Title:     nullStringToStringPtr(dbFeedFollow.Title),
 	}
 }
 
@@ -83,42 +155,167 @@ func databaseFeedFollowsToFeedFollows(dbFeedFollows []database.FeedFollow) []Fee
 	return feedFollows
 }
 
+type Folder struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UserID    uuid.UUID `json:"user_id"`
+	Name      string    `json:"name"`
+	Position  int32     `json:"position"`
+}
+
+func databaseFolderToFolder(dbFolder database.Folder) Folder {
+	return Folder{
+		ID:        dbFolder.ID,
+		CreatedAt: dbFolder.CreatedAt,
+		UpdatedAt: dbFolder.UpdatedAt,
+		UserID:    dbFolder.UserID,
+		Name:      dbFolder.Name,
+		Position:  dbFolder.Position,
+	}
+}
+
+func databaseFoldersToFolders(dbFolders []database.Folder) []Folder {
+	folders := []Folder{}
+
+	for _, dbFolder := range dbFolders {
+		folders = append(folders, databaseFolderToFolder(dbFolder))
+	}
+
+	return folders
+}
+
 type Post struct {
-	ID          uuid.UUID `json:"id"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-	Title       string    `json:"title"`
-	Description *string   `json:"description"`
-	PublishedAt time.Time `json:"published_at"`
-	Url         string    `json:"url"`
-	FeedID      uuid.UUID `json:"feed_id"`
+	ID                uuid.UUID  `json:"id"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+	Title             string     `json:"title"`
+	Description       *string    `json:"description"`
+	Content           *string    `json:"content"`
+	PublishedAt       time.Time  `json:"published_at"`
+	PublishedAtSource string     `json:"published_at_source"`
+	Url               string     `json:"url"`
+	FeedID            uuid.UUID  `json:"feed_id"`
+	Guid              *string    `json:"guid"`
+	Author            *string    `json:"author"`
+	Categories        []string   `json:"categories"`
+	Enclosure         *Enclosure `json:"enclosure"`
+	Read              bool       `json:"read"`
+	Starred           bool       `json:"starred"`
+}
+
+type Enclosure struct {
+	Url    string  `json:"url"`
+	Type   *string `json:"type"`
+	Length *int64  `json:"length"`
+}
+
+type PostSearchResult struct {
+	Post
+	Rank     float32 `json:"rank"`
+	Headline string  `json:"headline"`
+}
+
+func databaseSearchResultsToPostSearchResults(dbResults []database.SearchPostsForUserRow) []PostSearchResult {
+	results := []PostSearchResult{}
+
+	for _, dbResult := range dbResults {
+		results = append(results, PostSearchResult{
+			Post: Post{
+				ID:                dbResult.ID,
+				CreatedAt:         dbResult.CreatedAt,
+				UpdatedAt:         dbResult.UpdatedAt,
+				Title:             dbResult.Title,
+				Description:       nullStringToStringPtr(dbResult.Description),
+				Content:           nullStringToStringPtr(dbResult.Content),
+				PublishedAt:       dbResult.PublishedAt,
+				PublishedAtSource: dbResult.PublishedAtSource,
+				Url:               dbResult.Url,
+				FeedID:            dbResult.FeedID,
+				Guid:              nullStringToStringPtr(dbResult.Guid),
+				Author:            nullStringToStringPtr(dbResult.Author),
+				Categories:        dbResult.Categories,
+				Enclosure:         databaseEnclosureToEnclosure(dbResult.EnclosureUrl, dbResult.EnclosureType, dbResult.EnclosureLength),
+				Read:              dbResult.Read,
+				Starred:           dbResult.Starred,
+			},
+			Rank:     dbResult.Rank,
+			Headline: dbResult.Headline,
+		})
+	}
+
+	return results
 }
 
-func databasePostToPost(dbPost database.Post) Post {
-	var description *string
+func databaseEnclosureToEnclosure(url, contentType sql.NullString, length sql.NullInt64) *Enclosure {
+	if !url.Valid {
+		return nil
+	}
+
+	enclosure := &Enclosure{
+		Url:  url.String,
+		Type: nullStringToStringPtr(contentType),
+	}
 
-	if dbPost.Description.Valid {
-		description = &dbPost.Description.String
+	if length.Valid {
+		enclosure.Length = &length.Int64
 	}
 
+	return enclosure
+}
+
+func databasePostForUserToPost(dbPost database.GetPostForUserRow) Post {
 	return Post{
-		ID:          dbPost.ID,
-		CreatedAt:   dbPost.CreatedAt,
-		UpdatedAt:   dbPost.UpdatedAt,
-		Title:       dbPost.Title,
-		Description: description,
-		PublishedAt: dbPost.PublishedAt,
-		Url:         dbPost.Url,
-		FeedID:      dbPost.FeedID,
+		ID:                dbPost.ID,
+		CreatedAt:         dbPost.CreatedAt,
+		UpdatedAt:         dbPost.UpdatedAt,
+		Title:             dbPost.Title,
+		Description:       nullStringToStringPtr(dbPost.Description),
+		Content:           nullStringToStringPtr(dbPost.Content),
+		PublishedAt:       dbPost.PublishedAt,
+		PublishedAtSource: dbPost.PublishedAtSource,
+		Url:               dbPost.Url,
+		FeedID:            dbPost.FeedID,
+		Guid:              nullStringToStringPtr(dbPost.Guid),
+		Author:            nullStringToStringPtr(dbPost.Author),
+		Categories:        dbPost.Categories,
+		Enclosure:         databaseEnclosureToEnclosure(dbPost.EnclosureUrl, dbPost.EnclosureType, dbPost.EnclosureLength),
+		Read:              dbPost.Read,
+		Starred:           dbPost.Starred,
 	}
 }
 
-func databasePostsToPosts(dbPost []database.Post) []Post {
+func databasePostsForUserToPosts(dbPosts []database.GetPostsForUserRow) []Post {
 	posts := []Post{}
 
-	for _, dbPost := range dbPost {
-		posts = append(posts, databasePostToPost(dbPost))
+	for _, dbPost := range dbPosts {
+		posts = append(posts, databasePostForUserToPost(database.GetPostForUserRow(dbPost)))
 	}
 
 	return posts
 }
+
+func nullStringToStringPtr(s sql.NullString) *string {
+	if s.Valid {
+		return &s.String
+	}
+	return nil
+}
+
+func nullTimeToTimePtr(t sql.NullTime) *time.Time {
+	if t.Valid {
+		return &t.Time
+	}
+	return nil
+}
+
+func nullUUIDToUUIDPtr(id uuid.NullUUID) *uuid.UUID {
+	if id.Valid {
+		return &id.UUID
+	}
+	return nil
+}
+
+func stringToNullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/xml"
+	"strings"
+	"time"
+)
+
+// OPML 2.0, http://opml.org/spec2.opml
+type OPML struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    OPMLHead `xml:"head"`
+	Body    OPMLBody `xml:"body"`
+}
+
+type OPMLHead struct {
+	Title       string `xml:"title"`
+	DateCreated string `xml:"dateCreated,omitempty"`
+}
+
+type OPMLBody struct {
+	Outlines []OPMLOutline `xml:"outline"`
+}
+
+type OPMLOutline struct {
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr,omitempty"`
+	Type     string        `xml:"type,attr,omitempty"`
+	XMLURL   string        `xml:"xmlUrl,attr,omitempty"`
+	HTMLURL  string        `xml:"htmlUrl,attr,omitempty"`
+	Outlines []OPMLOutline `xml:"outline"`
+}
+
+// opmlSubscription is a feed outline with the folder it was nested in
+type opmlSubscription struct {
+	Title  string
+	URL    string
+	Folder string
+}
+
+func parseOPML(dat []byte) ([]opmlSubscription, error) {
+	opml := OPML{}
+
+	err := xml.Unmarshal(dat, &opml)
+	if err != nil {
+		return nil, err
+	}
+
+	return flattenOPMLOutlines(opml.Body.Outlines, ""), nil
+}
+
+// flattenOPMLOutlines walks nested outlines. An outline without xmlUrl is
+// a folder; nested folders are joined with "/".
+func flattenOPMLOutlines(outlines []OPMLOutline, folder string) []opmlSubscription {
+	subscriptions := []opmlSubscription{}
+
+	for _, outline := range outlines {
+		title := firstNonEmpty(outline.Title, outline.Text)
+
+		if strings.TrimSpace(outline.XMLURL) == "" {
+			subFolder := title
+			if folder != "" && title != "" {
+				subFolder = folder + "/" + title
+			} else if title == "" {
+				subFolder = folder
+			}
+			subscriptions = append(subscriptions, flattenOPMLOutlines(outline.Outlines, subFolder)...)
+			continue
+		}
+
+		subscriptions = append(subscriptions, opmlSubscription{
+			Title:  title,
+			URL:    strings.TrimSpace(outline.XMLURL),
+			Folder: folder,
+		})
+	}
+
+	return subscriptions
+}
+
+// buildOPML groups subscriptions by folder, a folder becomes an outline
+// holding its feeds. Subscriptions without a folder stay at the top level.
+func buildOPML(title string, subscriptions []opmlSubscription) OPML {
+	opml := OPML{
+		Version: "2.0",
+		Head: OPMLHead{
+			Title:       title,
+			DateCreated: time.Now().UTC().Format(time.RFC1123Z),
+		},
+	}
+
+	folderIndex := map[string]int{}
+
+	for _, subscription := range subscriptions {
+		outline := OPMLOutline{
+			Text:   subscription.Title,
+			Title:  subscription.Title,
+			Type:   "rss",
+			XMLURL: subscription.URL,
+		}
+
+		if subscription.Folder == "" {
+			opml.Body.Outlines = append(opml.Body.Outlines, outline)
+			continue
+		}
+
+		idx, ok := folderIndex[subscription.Folder]
+		if !ok {
+			idx = len(opml.Body.Outlines)
+			folderIndex[subscription.Folder] = idx
+			opml.Body.Outlines = append(opml.Body.Outlines, OPMLOutline{
+				Text:  subscription.Folder,
+				Title: subscription.Folder,
+			})
+		}
+
+		opml.Body.Outlines[idx].Outlines = append(opml.Body.Outlines[idx].Outlines, outline)
+	}
+
+	return opml
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/xml"
+	"reflect"
+	"testing"
+)
+
+const opmlSample = `<?xml version="1.0" encoding="UTF-8"?>
+<opml version="2.0">
+<head><title>Subscriptions</title></head>
+<body>
+	<outline text="Top level" type="rss" xmlUrl=" https://example.com/top.xml "/>
+	<outline text="Tech">
+		<outline text="Go blog" title="The Go Blog" type="rss" xmlUrl="https://go.dev/blog/feed.atom" htmlUrl="https://go.dev/blog"/>
+		<outline text="Databases">
+			<outline text="Postgres" type="rss" xmlUrl="https://example.com/pg.xml"/>
+			<outline text="">
+				<outline text="Untitled folder" type="rss" xmlUrl="https://example.com/untitled.xml"/>
+			</outline>
+		</outline>
+	</outline>
+	<outline title="News">
+		<outline text="Daily" type="rss" xmlUrl="https://example.com/daily.xml"/>
+	</outline>
+	<outline text="Empty folder"/>
+</body>
+</opml>`
+
+func TestParseOPML(t *testing.T) {
+	want := []opmlSubscription{
+		{Title: "Top level", URL: "https://example.com/top.xml"},
+		{Title: "The Go Blog", URL: "https://go.dev/blog/feed.atom", Folder: "Tech"},
+		{Title: "Postgres", URL: "https://example.com/pg.xml", Folder: "Tech/Databases"},
+		{Title: "Untitled folder", URL: "https://example.com/untitled.xml", Folder: "Tech/Databases"},
+		{Title: "Daily", URL: "https://example.com/daily.xml", Folder: "News"},
+	}
+
+	got, err := parseOPML([]byte(opmlSample))
+	if err != nil {
+		t.Fatalf("parseOPML() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseOPML() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseOPMLInvalid(t *testing.T) {
+	if _, err := parseOPML([]byte(`<opml><body>`)); err == nil {
+		t.Error("parseOPML() of truncated XML succeeded, want an error")
+	}
+}
+
+func TestOPMLRoundTrip(t *testing.T) {
+	subscriptions, err := parseOPML([]byte(opmlSample))
+	if err != nil {
+		t.Fatalf("parseOPML() error = %v", err)
+	}
+
+	dat, err := xml.Marshal(buildOPML("Subscriptions", subscriptions))
+	if err != nil {
+		t.Fatalf("xml.Marshal() error = %v", err)
+	}
+
+	got, err := parseOPML(dat)
+	if err != nil {
+		t.Fatalf("parseOPML() of built OPML error = %v", err)
+	}
+
+	if !reflect.DeepEqual(got, subscriptions) {
+		t.Errorf("parseOPML(buildOPML()) = %+v, want %+v", got, subscriptions)
+	}
+}
+
+func TestBuildOPML(t *testing.T) {
+	subscriptions := []opmlSubscription{
+		{Title: "Top level", URL: "https://example.com/top.xml"},
+		{Title: "Go", URL: "https://go.dev/blog/feed.atom", Folder: "Tech"},
+		{Title: "Postgres", URL: "https://example.com/pg.xml", Folder: "Tech/Databases"},
+		{Title: "Rust", URL: "https://example.com/rust.xml", Folder: "Tech"},
+	}
+
+	want := []OPMLOutline{
+		{Text: "Top level", Title: "Top level", Type: "rss", XMLURL: "https://example.com/top.xml"},
+		{Text: "Tech", Title: "Tech", Outlines: []OPMLOutline{
+			{Text: "Go", Title: "Go", Type: "rss", XMLURL: "https://go.dev/blog/feed.atom"},
+			{Text: "Rust", Title: "Rust", Type: "rss", XMLURL: "https://example.com/rust.xml"},
+		}},
+		{Text: "Tech/Databases", Title: "Tech/Databases", Outlines: []OPMLOutline{
+			{Text: "Postgres", Title: "Postgres", Type: "rss", XMLURL: "https://example.com/pg.xml"},
+		}},
+	}
+
+	opml := buildOPML("Subscriptions", subscriptions)
+
+	if opml.Version != "2.0" || opml.Head.Title != "Subscriptions" {
+		t.Errorf("buildOPML() version = %q, title = %q", opml.Version, opml.Head.Title)
+	}
+	if !reflect.DeepEqual(opml.Body.Outlines, want) {
+		t.Errorf("buildOPML() outlines = %+v, want %+v", opml.Body.Outlines, want)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPageSize = 10
+	maxPageSize     = 100
+)
+
+// postCursor is the position after the last post of a page. Posts are
+// ordered by (published_at, id) descending, so the id breaks ties between
+// posts published at the same time.
+type postCursor struct {
+	PublishedAt time.Time
+	ID          uuid.UUID
+}
+
+// encode returns an opaque token clients pass back as ?cursor=
+func (c postCursor) encode() string {
+	raw := c.PublishedAt.UTC().Format(time.RFC3339Nano) + "|" + c.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodePostCursor(token string) (postCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return postCursor{}, errors.New("malformed cursor")
+	}
+
+	publishedAtStr, idStr, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return postCursor{}, errors.New("malformed cursor")
+	}
+
+	publishedAt, err := time.Parse(time.RFC3339Nano, publishedAtStr)
+	if err != nil {
+		return postCursor{}, errors.New("malformed cursor")
+	}
+
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return postCursor{}, errors.New("malformed cursor")
+	}
+
+	return postCursor{PublishedAt: publishedAt, ID: id}, nil
+}
+
+// parsePageSize reads ?limit=, defaulting to defaultPageSize and
+// capping it at maxPageSize
+func parsePageSize(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("limit")
+	if value == "" {
+		return defaultPageSize, nil
+	}
+
+	size, err := strconv.Atoi(value)
+	if err != nil || size < 1 {
+		return 0, fmt.Errorf("invalid limit %q, expected a positive number", value)
+	}
+
+	return min(size, maxPageSize), nil
+}
+
+// setNextPageLink points the Link header at the same request with the
+// cursor replaced, keeping the client's filters and page size
+func setNextPageLink(w http.ResponseWriter, r *http.Request, cursor postCursor) {
+	query := r.URL.Query()
+	query.Set("cursor", cursor.encode())
+
+	next := url.URL{
+		Path:     r.URL.Path,
+		RawQuery: query.Encode(),
+	}
+
+	w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next.String()))
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func encodeRawCursor(raw string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func TestPostCursorRoundTrip(t *testing.T) {
+	id := uuid.MustParse("0b6e1f5c-2c0d-4a53-9a8e-6c3a3d1e2f40")
+
+	tests := []struct {
+		name   string
+		cursor postCursor
+	}{
+		{name: "utc", cursor: postCursor{PublishedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), ID: id}},
+		{name: "nanoseconds", cursor: postCursor{PublishedAt: time.Date(2024, 5, 1, 12, 0, 0, 123456789, time.UTC), ID: id}},
+		{
+			name:   "other zone",
+			cursor: postCursor{PublishedAt: time.Date(2024, 5, 1, 14, 0, 0, 0, time.FixedZone("CEST", 2*60*60)), ID: id},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodePostCursor(tt.cursor.encode())
+			if err != nil {
+				t.Fatalf("decodePostCursor() error = %v", err)
+			}
+
+			if !got.PublishedAt.Equal(tt.cursor.PublishedAt) || got.ID != tt.cursor.ID {
+				t.Errorf("decodePostCursor() = %+v, want %+v", got, tt.cursor)
+			}
+		})
+	}
+}
+
+func TestDecodePostCursorErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "empty", token: ""},
+		{name: "bad base64", token: "not base64!"},
+		{name: "missing separator", token: encodeRawCursor("2024-05-01T12:00:00Z")},
+		{name: "bad timestamp", token: encodeRawCursor("yesterday|0b6e1f5c-2c0d-4a53-9a8e-6c3a3d1e2f40")},
+		{name: "bad uuid", token: encodeRawCursor("2024-05-01T12:00:00Z|nope")},
+		{name: "empty uuid", token: encodeRawCursor("2024-05-01T12:00:00Z|")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := decodePostCursor(tt.token); err == nil {
+				t.Errorf("decodePostCursor(%q) = %+v, want an error", tt.token, got)
+			}
+		})
+	}
+}
+
+func TestParsePageSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    int
+		wantErr bool
+	}{
+		{name: "default", query: "", want: defaultPageSize},
+		{name: "empty value", query: "?limit=", want: defaultPageSize},
+		{name: "within range", query: "?limit=25", want: 25},
+		{name: "smallest", query: "?limit=1", want: 1},
+		{name: "at max", query: "?limit=100", want: maxPageSize},
+		{name: "clamped to max", query: "?limit=1000", want: maxPageSize},
+		{name: "zero", query: "?limit=0", wantErr: true},
+		{name: "negative", query: "?limit=-5", wantErr: true},
+		{name: "not a number", query: "?limit=ten", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/v1/posts"+tt.query, nil)
+
+			got, err := parsePageSize(r)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePageSize(%q) error = %v, wantErr %v", tt.query, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parsePageSize(%q) = %d, want %d", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetNextPageLink(t *testing.T) {
+	cursor := postCursor{
+		PublishedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		ID:          uuid.MustParse("0b6e1f5c-2c0d-4a53-9a8e-6c3a3d1e2f40"),
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/posts?limit=5&cursor=old&unread=true", nil)
+	w := httptest.NewRecorder()
+
+	setNextPageLink(w, r, cursor)
+
+	want := `</v1/posts?cursor=` + cursor.encode() + `&limit=5&unread=true>; rel="next"`
+	if got := w.Header().Get("Link"); got != want {
+		t.Errorf("Link = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+// Where the published_at of a post came from
+const (
+	pubDateSourceItem  = "item"
+	pubDateSourceFeed  = "feed"
+	pubDateSourceFetch = "fetch"
+)
+
+// Layouts seen in real feeds, tried in order. RFC 822 variants come
+// first since RSS 2.0 is the most common format.
+var pubDateLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"Mon, 2 Jan 2006 15:04 -0700",
+	"Mon, 2 Jan 2006 15:04 MST",
+	"Mon, 2 Jan 06 15:04:05 -0700",
+	"Mon, 2 Jan 06 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04 -0700",
+	"2 Jan 2006 15:04 MST",
+	"Monday, 2 Jan 2006 15:04:05 -0700",
+	"Monday, 2 Jan 2006 15:04:05 MST",
+	time.RFC3339Nano,
+	time.RFC3339,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	time.RFC850,
+	time.RubyDate,
+	time.UnixDate,
+	time.ANSIC,
+}
+
+// time.Parse only knows the offset of the local zone abbreviation,
+// every other name parses as UTC, so the usual ones are rewritten
+// to numeric offsets first.
+var zoneAbbreviations = strings.NewReplacer(
+	" UTC", " +0000",
+	" UT", " +0000",
+	" GMT", " +0000",
+	" Z", " +0000",
+	" EST", " -0500",
+	" EDT", " -0400",
+	" CST", " -0600",
+	" CDT", " -0500",
+	" MST", " -0700",
+	" MDT", " -0600",
+	" PST", " -0800",
+	" PDT", " -0700",
+)
+
+// parsePubDate parses a date string from a feed using the
+// first layout in pubDateLayouts that matches
+func parsePubDate(value string) (time.Time, bool) {
+	value = strings.Join(strings.Fields(value), " ")
+	if value == "" {
+		return time.Time{}, false
+	}
+
+	candidates := []string{value}
+	if replaced := replaceZoneAbbreviation(value); replaced != value {
+		candidates = []string{replaced, value}
+	}
+
+	for _, candidate := range candidates {
+		for _, layout := range pubDateLayouts {
+			t, err := time.Parse(layout, candidate)
+			if err == nil {
+				return t.UTC(), true
+			}
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// replaceZoneAbbreviation only touches a trailing abbreviation,
+// so words inside the date such as month names are left alone
+func replaceZoneAbbreviation(value string) string {
+	idx := strings.LastIndex(value, " ")
+	if idx < 0 {
+		return value
+	}
+
+	return value[:idx] + zoneAbbreviations.Replace(value[idx:])
+}
+
+// resolvePubDate returns the publish date of an item, falling back to
+// the feed's own build date and then to the fetch time, along with
+// which of those was used
+func resolvePubDate(itemDate, feedDate string, fetchedAt time.Time) (time.Time, string) {
+	if t, ok := parsePubDate(itemDate); ok {
+		return t, pubDateSourceItem
+	}
+
+	if t, ok := parsePubDate(feedDate); ok {
+		return t, pubDateSourceFeed
+	}
+
+	return fetchedAt.UTC(), pubDateSourceFetch
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParsePubDate(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		want   time.Time
+		wantOK bool
+	}{
+		{
+			name:   "RFC 1123 with offset",
+			value:  "Mon, 02 Jan 2006 15:04:05 +0200",
+			want:   time.Date(2006, 1, 2, 13, 4, 5, 0, time.UTC),
+			wantOK: true,
+		},
+		{
+			name:   "GMT",
+			value:  "Mon, 02 Jan 2006 15:04:05 GMT",
+			want:   time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
+			wantOK: true,
+		},
+		{
+			name:   "US zone abbreviation is rewritten to its offset",
+			value:  "Mon, 02 Jan 2006 15:04:05 EST",
+			want:   time.Date(2006, 1, 2, 20, 4, 5, 0, time.UTC),
+			wantOK: true,
+		},
+		{
+			name:   "daylight saving abbreviation",
+			value:  "Mon, 3 Jul 2006 09:00:00 PDT",
+			want:   time.Date(2006, 7, 3, 16, 0, 0, 0, time.UTC),
+			wantOK: true,
+		},
+		{
+			name:   "unknown abbreviation parses as UTC",
+			value:  "Mon, 02 Jan 2006 15:04:05 XYZ",
+			want:   time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
+			wantOK: true,
+		},
+		{
+			name:   "single digit day without seconds",
+			value:  "Mon, 2 Jan 2006 15:04 +0000",
+			want:   time.Date(2006, 1, 2, 15, 4, 0, 0, time.UTC),
+			wantOK: true,
+		},
+		{
+			name:   "two digit year",
+			value:  "Mon, 2 Jan 06 15:04:05 +0000",
+			want:   time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
+			wantOK: true,
+		},
+		{
+			name:   "no weekday",
+			value:  "2 Jan 2006 15:04:05 +0000",
+			want:   time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
+			wantOK: true,
+		},
+		{
+			name:   "extra whitespace",
+			value:  "  Mon,  02 Jan 2006\n15:04:05 +0000 ",
+			want:   time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
+			wantOK: true,
+		},
+		{
+			name:   "RFC 3339",
+			value:  "2006-01-02T15:04:05-07:00",
+			want:   time.Date(2006, 1, 2, 22, 4, 5, 0, time.UTC),
+			wantOK: true,
+		},
+		{
+			name:   "RFC 3339 with fraction",
+			value:  "2006-01-02T15:04:05.5Z",
+			want:   time.Date(2006, 1, 2, 15, 4, 5, 500000000, time.UTC),
+			wantOK: true,
+		},
+		{
+			name:   "RFC 3339 without seconds",
+			value:  "2006-01-02T15:04Z",
+			want:   time.Date(2006, 1, 2, 15, 4, 0, 0, time.UTC),
+			wantOK: true,
+		},
+		{
+			name:   "date only",
+			value:  "2006-01-02",
+			want:   time.Date(2006, 1, 2, 0, 0, 0, 0, time.UTC),
+			wantOK: true,
+		},
+		{
+			name:   "Unix date",
+			value:  "Mon Jan 2 15:04:05 UTC 2006",
+			want:   time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
+			wantOK: true,
+		},
+		{
+			name:   "empty",
+			value:  "   ",
+			wantOK: false,
+		},
+		{
+			name:   "garbage",
+			value:  "yesterday",
+			wantOK: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parsePubDate(tt.value)
+
+			if ok != tt.wantOK {
+				t.Fatalf("parsePubDate(%q) ok = %v, want %v", tt.value, ok, tt.wantOK)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("parsePubDate(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolvePubDate(t *testing.T) {
+	fetchedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+
+	tests := []struct {
+		name       string
+		itemDate   string
+		feedDate   string
+		want       time.Time
+		wantSource string
+	}{
+		{
+			name:       "item date",
+			itemDate:   "2006-01-02T15:04:05Z",
+			feedDate:   "2007-01-02T15:04:05Z",
+			want:       time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
+			wantSource: pubDateSourceItem,
+		},
+		{
+			name:       "unparsable item date falls back to the feed date",
+			itemDate:   "sometime",
+			feedDate:   "2007-01-02T15:04:05Z",
+			want:       time.Date(2007, 1, 2, 15, 4, 5, 0, time.UTC),
+			wantSource: pubDateSourceFeed,
+		},
+		{
+			name:       "missing item date falls back to the feed date",
+			feedDate:   "Tue, 02 Jan 2007 15:04:05 GMT",
+			want:       time.Date(2007, 1, 2, 15, 4, 5, 0, time.UTC),
+			wantSource: pubDateSourceFeed,
+		},
+		{
+			name:       "no usable date falls back to the fetch time",
+			itemDate:   "sometime",
+			feedDate:   "",
+			want:       fetchedAt,
+			wantSource: pubDateSourceFetch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, source := resolvePubDate(tt.itemDate, tt.feedDate, fetchedAt)
+
+			if source != tt.wantSource {
+				t.Errorf("resolvePubDate() source = %q, want %q", source, tt.wantSource)
+			}
+			if !got.Equal(tt.want) || got.Location() != time.UTC {
+				t.Errorf("resolvePubDate() = %v, want %v in UTC", got, tt.want)
+			}
+		})
+	}
+}
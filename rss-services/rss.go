@@ -1,55 +1,661 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/xml"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/html/charset"
+)
+
+type FeedFormat string
+
+const (
+	FeedFormatRSS  FeedFormat = "rss"
+	FeedFormatRDF  FeedFormat = "rdf"
+	FeedFormatAtom FeedFormat = "atom"
 )
 
+// ParsedFeed is a feed normalized from any of the supported formats
+type ParsedFeed struct {
+	Format      FeedFormat
+	Title       string
+	Link        string
+	Description string
+	Updated     string
+	// TTL is how long the publisher asks readers to cache the feed,
+	// from <ttl> or the syndication module, zero when absent
+	TTL   time.Duration
+	Items []FeedItem
+}
+
+// FeedItem is a single RSS item or Atom entry
+type FeedItem struct {
+	ID          string
+	Title       string
+	Link        string
+	Description string
+	Content     string
+	PubDate     string
+	Author      string
+	Categories  []string
+	Enclosure   *FeedEnclosure
+}
+
+// FeedEnclosure is an attached media file, e.g. a podcast episode
+type FeedEnclosure struct {
+	URL    string
+	Type   string
+	Length int64
+}
+
+// RSS 2.0
+
 type RSSFeed struct {
 	Channel struct {
-		Title       string    `xml:"title"`
-		Link        string    `xml:"link"`
-		Description string    `xml:"description"`
-		Language    string    `xml:"Language"`
-		Item        []RSSItem `xml:"item"`
+		Title         string    `xml:"title"`
+		Links         []RSSLink `xml:"link"`
+		Description   string    `xml:"description"`
+		Language      string    `xml:"Language"`
+		LastBuildDate string    `xml:"lastBuildDate"`
+		PubDate       string    `xml:"pubDate"`
+		TTL           string    `xml:"ttl"`
+		Syndication
+		Item []RSSItem `xml:"item"`
 	} `xml:"channel"`
 }
 
 type RSSItem struct {
-	Title       string `xml:"title"`
-	Link        string `xml:"link"`
-	Description string `xml:"description"`
-	PubDate     string `xml:"pubDate"`
+	GUID        string        `xml:"guid"`
+	Title       string        `xml:"title"`
+	Links       []RSSLink     `xml:"link"`
+	Description string        `xml:"description"`
+	Content     string        `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	PubDate     string        `xml:"pubDate"`
+	Author      string        `xml:"author"`
+	Creator     string        `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Categories  []string      `xml:"category"`
+	Enclosure   *RSSEnclosure `xml:"enclosure"`
+}
+
+type RSSEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Type   string `xml:"type,attr"`
+	Length string `xml:"length,attr"`
+}
+
+// RSSLink keeps the namespace so an <atom:link> inside a channel
+// does not override the plain RSS <link>
+type RSSLink struct {
+	XMLName xml.Name
+	Href    string `xml:"href,attr"`
+	Value   string `xml:",chardata"`
+}
+
+// Syndication holds the update hints of the RSS syndication module
+// http://web.resource.org/rss/1.0/modules/syndication/
+type Syndication struct {
+	UpdatePeriod    string `xml:"http://purl.org/rss/1.0/modules/syndication/ updatePeriod"`
+	UpdateFrequency string `xml:"http://purl.org/rss/1.0/modules/syndication/ updateFrequency"`
+}
+
+// Interval is the update period divided by the number of updates in it
+func (sy Syndication) Interval() time.Duration {
+	var period time.Duration
+
+	switch strings.ToLower(strings.TrimSpace(sy.UpdatePeriod)) {
+	case "hourly":
+		period = time.Hour
+	case "daily":
+		period = 24 * time.Hour
+	case "weekly":
+		period = 7 * 24 * time.Hour
+	case "monthly":
+		period = 30 * 24 * time.Hour
+	case "yearly":
+		period = 365 * 24 * time.Hour
+	default:
+		return 0
+	}
+
+	frequency, err := strconv.Atoi(strings.TrimSpace(sy.UpdateFrequency))
+	if err != nil || frequency < 1 {
+		frequency = 1
+	}
+
+	return period / time.Duration(frequency)
+}
+
+// RSS 1.0 (RDF)
+
+type RDFFeed struct {
+	Channel struct {
+		Title       string `xml:"title"`
+		Link        string `xml:"link"`
+		Description string `xml:"description"`
+		Date        string `xml:"http://purl.org/dc/elements/1.1/ date"`
+		Syndication
+	} `xml:"channel"`
+	Item []RDFItem `xml:"item"`
+}
+
+type RDFItem struct {
+	About       string   `xml:"about,attr"`
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	Description string   `xml:"description"`
+	Content     string   `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	Date        string   `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Creator     string   `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Subjects    []string `xml:"http://purl.org/dc/elements/1.1/ subject"`
+}
+
+// Atom 1.0
+
+type AtomFeed struct {
+	Title    AtomText    `xml:"title"`
+	Subtitle AtomText    `xml:"subtitle"`
+	Links    []AtomLink  `xml:"link"`
+	Updated  string      `xml:"updated"`
+	Entry    []AtomEntry `xml:"entry"`
+}
+
+type AtomEntry struct {
+	ID         string         `xml:"id"`
+	Title      AtomText       `xml:"title"`
+	Links      []AtomLink     `xml:"link"`
+	Summary    AtomText       `xml:"summary"`
+	Content    AtomText       `xml:"content"`
+	Updated    string         `xml:"updated"`
+	Published  string         `xml:"published"`
+	Authors    []AtomPerson   `xml:"author"`
+	Categories []AtomCategory `xml:"category"`
+}
+
+type AtomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr"`
+	Type   string `xml:"type,attr"`
+	Length string `xml:"length,attr"`
+}
+
+type AtomPerson struct {
+	Name string `xml:"name"`
+}
+
+type AtomCategory struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr"`
+}
+
+// AtomText holds both decoded text and raw markup, because
+// type="xhtml" constructs carry their content as child elements
+type AtomText struct {
+	Type  string `xml:"type,attr"`
+	Text  string `xml:",chardata"`
+	Inner string `xml:",innerxml"`
 }
 
-func urlToFeed(url string) (RSSFeed, error) {
-	httpClient := http.Client{
-		Timeout: 10 * time.Second,
+func (t AtomText) String() string {
+	if t.Type == "xhtml" {
+		return strings.TrimSpace(t.Inner)
 	}
+	return strings.TrimSpace(t.Text)
+}
+
+// feedFetch is the result of a conditional GET of a feed.
+// When NotModified is set, Feed is empty and was not parsed.
+type feedFetch struct {
+	Feed         ParsedFeed
+	NotModified  bool
+	ETag         string
+	LastModified string
+	// MaxAge is the freshness lifetime from Cache-Control or Expires
+	MaxAge time.Duration
+	// StatusCode and Size describe the response, they are set even
+	// when urlToFeed fails after a response was received
+	StatusCode int
+	Size       int
+}
 
-	resp, err := httpClient.Get(url)
+// Feeds larger than this are rejected rather than parsed
+const maxFeedSize = 10 << 20
+
+var (
+	// errFeedParse wraps errors from parsing a fetched body
+	errFeedParse = errors.New("couldn't parse feed")
+	// errFeedTooLarge is returned for bodies over maxFeedSize
+	errFeedTooLarge = fmt.Errorf("feed is larger than %v bytes", maxFeedSize)
+)
+
+// urlToFeed fetches and parses the feed at url, in a span of its own
+func urlToFeed(ctx context.Context, url, etag, lastModified string) (feedFetch, error) {
+	ctx, span := tracer.Start(ctx, "urlToFeed",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(http.MethodGet),
+			semconv.URLFull(url),
+		),
+	)
+	defer span.End()
+
+	fetch, err := fetchFeed(ctx, url, etag, lastModified)
+
+	if fetch.StatusCode != 0 {
+		span.SetAttributes(semconv.HTTPResponseStatusCode(fetch.StatusCode))
+	}
+
+	span.SetAttributes(
+		attribute.Bool("feed.not_modified", fetch.NotModified),
+		attribute.Int("feed.size", fetch.Size),
+	)
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	return fetch, err
+}
+
+func fetchFeed(ctx context.Context, url, etag, lastModified string) (feedFetch, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 
 	if err != nil {
-		return RSSFeed{}, err
+		return feedFetch{}, err
+	}
+
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	if lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	// Propagates our trace to publishers that trace their requests
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := feedHTTPClient.Do(req)
+
+	if err != nil {
+		return feedFetch{}, err
 	}
 
 	defer resp.Body.Close()
 
-	dat, err := io.ReadAll(resp.Body)
+	fetch := feedFetch{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		MaxAge:       cacheMaxAge(resp.Header),
+		StatusCode:   resp.StatusCode,
+	}
+
+	if resp.StatusCode == http.StatusNotModified {
+		// A 304 may omit the validators, keep the ones we sent
+		if fetch.ETag == "" {
+			fetch.ETag = etag
+		}
+		if fetch.LastModified == "" {
+			fetch.LastModified = lastModified
+		}
+		fetch.NotModified = true
+		return fetch, nil
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return feedFetch{StatusCode: resp.StatusCode}, fmt.Errorf("unexpected status code %v", resp.StatusCode)
+	}
+
+	// One byte more than allowed tells a feed of exactly maxFeedSize apart
+	// from a larger one
+	dat, err := io.ReadAll(io.LimitReader(resp.Body, maxFeedSize+1))
+
+	if err != nil {
+		return feedFetch{StatusCode: resp.StatusCode}, err
+	}
+
+	if len(dat) > maxFeedSize {
+		return feedFetch{StatusCode: resp.StatusCode, Size: len(dat)}, errFeedTooLarge
+	}
+
+	fetch.Size = len(dat)
+
+	fetch.Feed, err = parseFeed(dat)
 
 	if err != nil {
-		return RSSFeed{}, err
+		return feedFetch{StatusCode: resp.StatusCode, Size: len(dat)}, fmt.Errorf("%w: %w", errFeedParse, err)
 	}
 
-	rssFeed := RSSFeed{}
+	return fetch, nil
+}
 
-	err = xml.Unmarshal(dat, &rssFeed)
+// cacheMaxAge reads max-age from Cache-Control, falling back to Expires
+func cacheMaxAge(header http.Header) time.Duration {
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-cache", "no-store":
+			return 0
+		case "max-age":
+			seconds, err := strconv.Atoi(strings.Trim(value, `"`))
+			if err != nil || seconds < 0 {
+				return 0
+			}
+			return time.Duration(seconds) * time.Second
+		}
+	}
 
+	expires, err := http.ParseTime(header.Get("Expires"))
 	if err != nil {
-		return RSSFeed{}, err
+		return 0
+	}
+
+	return max(time.Until(expires), 0)
+}
+
+// parseFeed detects the feed format from the root element
+// and decodes it into a ParsedFeed
+func parseFeed(dat []byte) (ParsedFeed, error) {
+	format, err := detectFeedFormat(dat)
+	if err != nil {
+		return ParsedFeed{}, err
+	}
+
+	switch format {
+	case FeedFormatRDF:
+		rdfFeed := RDFFeed{}
+		if err := newFeedDecoder(dat).Decode(&rdfFeed); err != nil {
+			return ParsedFeed{}, err
+		}
+		return rdfFeed.toParsedFeed(), nil
+	case FeedFormatAtom:
+		atomFeed := AtomFeed{}
+		if err := newFeedDecoder(dat).Decode(&atomFeed); err != nil {
+			return ParsedFeed{}, err
+		}
+		return atomFeed.toParsedFeed(), nil
+	default:
+		rssFeed := RSSFeed{}
+		if err := newFeedDecoder(dat).Decode(&rssFeed); err != nil {
+			return ParsedFeed{}, err
+		}
+		return rssFeed.toParsedFeed(), nil
+	}
+}
+
+// newFeedDecoder decodes feeds in any encoding their XML declaration
+// names, like ISO-8859-1 or windows-1252, not only UTF-8
+func newFeedDecoder(dat []byte) *xml.Decoder {
+	decoder := xml.NewDecoder(bytes.NewReader(dat))
+	decoder.CharsetReader = charset.NewReaderLabel
+	return decoder
+}
+
+func detectFeedFormat(dat []byte) (FeedFormat, error) {
+	decoder := newFeedDecoder(dat)
+	decoder.Strict = false
+
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return "", errors.New("empty feed document")
+		}
+		if err != nil {
+			return "", err
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch strings.ToLower(start.Name.Local) {
+		case "rss":
+			return FeedFormatRSS, nil
+		case "rdf":
+			return FeedFormatRDF, nil
+		case "feed":
+			return FeedFormatAtom, nil
+		default:
+			return "", fmt.Errorf("unsupported feed format <%s>", start.Name.Local)
+		}
+	}
+}
+
+func (rssFeed RSSFeed) toParsedFeed() ParsedFeed {
+	updated := rssFeed.Channel.LastBuildDate
+	if strings.TrimSpace(updated) == "" {
+		updated = rssFeed.Channel.PubDate
+	}
+
+	feed := ParsedFeed{
+		Format:      FeedFormatRSS,
+		Title:       strings.TrimSpace(rssFeed.Channel.Title),
+		Link:        rssLink(rssFeed.Channel.Links),
+		Description: strings.TrimSpace(rssFeed.Channel.Description),
+		Updated:     strings.TrimSpace(updated),
+		TTL:         max(rssTTL(rssFeed.Channel.TTL), rssFeed.Channel.Syndication.Interval()),
+		Items:       []FeedItem{},
+	}
+
+	for _, item := range rssFeed.Channel.Item {
+		feed.Items = append(feed.Items, FeedItem{
+			ID:          strings.TrimSpace(item.GUID),
+			Title:       strings.TrimSpace(item.Title),
+			Link:        rssLink(item.Links),
+			Description: strings.TrimSpace(item.Description),
+			Content:     strings.TrimSpace(item.Content),
+			PubDate:     strings.TrimSpace(item.PubDate),
+			Author:      firstNonEmpty(item.Creator, item.Author),
+			Categories:  cleanCategories(item.Categories),
+			Enclosure:   item.Enclosure.toFeedEnclosure(),
+		})
+	}
+
+	return feed
+}
+
+func (enclosure *RSSEnclosure) toFeedEnclosure() *FeedEnclosure {
+	if enclosure == nil || strings.TrimSpace(enclosure.URL) == "" {
+		return nil
+	}
+
+	return &FeedEnclosure{
+		URL:    strings.TrimSpace(enclosure.URL),
+		Type:   strings.TrimSpace(enclosure.Type),
+		Length: parseEnclosureLength(enclosure.Length),
+	}
+}
+
+// rssTTL parses the <ttl> element, a number of minutes
+func rssTTL(ttl string) time.Duration {
+	minutes, err := strconv.Atoi(strings.TrimSpace(ttl))
+	if err != nil || minutes < 0 {
+		return 0
+	}
+
+	return time.Duration(minutes) * time.Minute
+}
+
+// rssLink returns the first link without a namespace, falling back
+// to the href of a namespaced link such as <atom:link>
+func rssLink(links []RSSLink) string {
+	for _, link := range links {
+		if link.XMLName.Space == "" && strings.TrimSpace(link.Value) != "" {
+			return strings.TrimSpace(link.Value)
+		}
+	}
+
+	for _, link := range links {
+		if link.Href != "" {
+			return link.Href
+		}
+	}
+
+	return ""
+}
+
+func (rdfFeed RDFFeed) toParsedFeed() ParsedFeed {
+	feed := ParsedFeed{
+		Format:      FeedFormatRDF,
+		Title:       strings.TrimSpace(rdfFeed.Channel.Title),
+		Link:        strings.TrimSpace(rdfFeed.Channel.Link),
+		Description: strings.TrimSpace(rdfFeed.Channel.Description),
+		Updated:     strings.TrimSpace(rdfFeed.Channel.Date),
+		TTL:         rdfFeed.Channel.Syndication.Interval(),
+		Items:       []FeedItem{},
+	}
+
+	for _, item := range rdfFeed.Item {
+		feed.Items = append(feed.Items, FeedItem{
+			ID:          strings.TrimSpace(item.About),
+			Title:       strings.TrimSpace(item.Title),
+			Link:        strings.TrimSpace(item.Link),
+			Description: strings.TrimSpace(item.Description),
+			Content:     strings.TrimSpace(item.Content),
+			PubDate:     strings.TrimSpace(item.Date),
+			Author:      strings.TrimSpace(item.Creator),
+			Categories:  cleanCategories(item.Subjects),
+		})
+	}
+
+	return feed
+}
+
+func (atomFeed AtomFeed) toParsedFeed() ParsedFeed {
+	feed := ParsedFeed{
+		Format:      FeedFormatAtom,
+		Title:       atomFeed.Title.String(),
+		Link:        atomAlternateLink(atomFeed.Links),
+		Description: atomFeed.Subtitle.String(),
+		Updated:     strings.TrimSpace(atomFeed.Updated),
+		Items:       []FeedItem{},
+	}
+
+	for _, entry := range atomFeed.Entry {
+		pubDate := entry.Published
+		if pubDate == "" {
+			pubDate = entry.Updated
+		}
+
+		feed.Items = append(feed.Items, FeedItem{
+			ID:          strings.TrimSpace(entry.ID),
+			Title:       entry.Title.String(),
+			Link:        atomAlternateLink(entry.Links),
+			Description: entry.Summary.String(),
+			Content:     entry.Content.String(),
+			PubDate:     strings.TrimSpace(pubDate),
+			Author:      atomAuthor(entry.Authors),
+			Categories:  atomCategories(entry.Categories),
+			Enclosure:   atomEnclosure(entry.Links),
+		})
+	}
+
+	return feed
+}
+
+// atomAlternateLink picks the rel="alternate" link, preferring HTML.
+// A link without rel is an alternate link per RFC 4287.
+func atomAlternateLink(links []AtomLink) string {
+	alternate := ""
+
+	for _, link := range links {
+		if link.Rel != "" && link.Rel != "alternate" {
+			continue
+		}
+		if link.Type == "" || link.Type == "text/html" {
+			return link.Href
+		}
+		if alternate == "" {
+			alternate = link.Href
+		}
+	}
+
+	return alternate
+}
+
+func atomAuthor(authors []AtomPerson) string {
+	names := []string{}
+
+	for _, author := range authors {
+		if name := strings.TrimSpace(author.Name); name != "" {
+			names = append(names, name)
+		}
 	}
 
-	return rssFeed, nil
+	return strings.Join(names, ", ")
+}
+
+func atomCategories(categories []AtomCategory) []string {
+	values := []string{}
+
+	for _, category := range categories {
+		values = append(values, firstNonEmpty(category.Label, category.Term))
+	}
+
+	return cleanCategories(values)
+}
+
+func atomEnclosure(links []AtomLink) *FeedEnclosure {
+	for _, link := range links {
+		if link.Rel == "enclosure" && link.Href != "" {
+			return &FeedEnclosure{
+				URL:    link.Href,
+				Type:   link.Type,
+				Length: parseEnclosureLength(link.Length),
+			}
+		}
+	}
+
+	return nil
+}
+
+// cleanCategories trims categories and drops empty and repeated ones
+func cleanCategories(categories []string) []string {
+	cleaned := []string{}
+	seen := map[string]bool{}
+
+	for _, category := range categories {
+		category = strings.TrimSpace(category)
+		if category == "" || seen[category] {
+			continue
+		}
+		seen[category] = true
+		cleaned = append(cleaned, category)
+	}
+
+	return cleaned
+}
+
+// parseEnclosureLength returns 0 when the length is missing or invalid,
+// which publishers often leave at "0" or empty anyway
+func parseEnclosureLength(length string) int64 {
+	n, err := strconv.ParseInt(strings.TrimSpace(length), 10, 64)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			return value
+		}
+	}
+	return ""
 }
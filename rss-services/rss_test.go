@@ -0,0 +1,221 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+const rssSample = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0"
+	xmlns:atom="http://www.w3.org/2005/Atom"
+	xmlns:content="http://purl.org/rss/1.0/modules/content/"
+	xmlns:dc="http://purl.org/dc/elements/1.1/">
+<channel>
+	<title> Example Blog </title>
+	<atom:link href="https://example.com/feed.xml" rel="self" type="application/rss+xml"/>
+	<link>https://example.com/</link>
+	<description>Posts about things</description>
+	<lastBuildDate>Mon, 02 Jan 2006 15:04:05 +0000</lastBuildDate>
+	<ttl>60</ttl>
+	<item>
+		<guid>https://example.com/first</guid>
+		<title>First post</title>
+		<link>https://example.com/first</link>
+		<description>Summary</description>
+		<content:encoded><![CDATA[<p>Full text</p>]]></content:encoded>
+		<pubDate>Mon, 02 Jan 2006 15:04:05 +0000</pubDate>
+		<author>jane@example.com (Jane)</author>
+		<dc:creator>Jane Doe</dc:creator>
+		<category>go</category>
+		<category> go </category>
+		<category>rss</category>
+		<enclosure url="https://example.com/first.mp3" type="audio/mpeg" length="1234"/>
+	</item>
+</channel>
+</rss>`
+
+const rdfSample = `<?xml version="1.0"?>
+<rdf:RDF
+	xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	xmlns="http://purl.org/rss/1.0/"
+	xmlns:dc="http://purl.org/dc/elements/1.1/"
+	xmlns:sy="http://purl.org/rss/1.0/modules/syndication/">
+<channel rdf:about="https://example.org/">
+	<title>Example RDF</title>
+	<link>https://example.org/</link>
+	<description>An RSS 1.0 feed</description>
+	<dc:date>2006-01-02T15:04:05Z</dc:date>
+	<sy:updatePeriod>daily</sy:updatePeriod>
+	<sy:updateFrequency>2</sy:updateFrequency>
+</channel>
+<item rdf:about="https://example.org/item">
+	<title>An item</title>
+	<link>https://example.org/item</link>
+	<description>Item summary</description>
+	<dc:date>2006-01-02T15:04:05Z</dc:date>
+	<dc:creator>John</dc:creator>
+	<dc:subject>news</dc:subject>
+</item>
+</rdf:RDF>`
+
+const atomSample = `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+	<title type="text">Example Atom</title>
+	<subtitle>All the news</subtitle>
+	<link rel="self" href="https://example.net/atom.xml"/>
+	<link rel="alternate" type="text/html" href="https://example.net/"/>
+	<updated>2006-01-02T15:04:05Z</updated>
+	<entry>
+		<id>urn:uuid:1225c695-cfb8-4ebb-aaaa-80da344efa6a</id>
+		<title>Entry</title>
+		<link href="https://example.net/entry"/>
+		<link rel="enclosure" type="audio/mpeg" length="42" href="https://example.net/entry.mp3"/>
+		<summary>Short</summary>
+		<content type="xhtml"><div xmlns="http://www.w3.org/1999/xhtml"><p>Long</p></div></content>
+		<updated>2006-01-03T15:04:05Z</updated>
+		<author><name>Ann</name></author>
+		<author><name>Bob</name></author>
+		<category term="tech" label="Technology"/>
+		<category term="misc"/>
+	</entry>
+</feed>`
+
+const latin1Sample = "<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?>\n" +
+	"<rss version=\"2.0\"><channel><title>Caf\xe9</title></channel></rss>"
+
+func TestDetectFeedFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		dat     string
+		want    FeedFormat
+		wantErr bool
+	}{
+		{name: "rss", dat: rssSample, want: FeedFormatRSS},
+		{name: "rdf", dat: rdfSample, want: FeedFormatRDF},
+		{name: "atom", dat: atomSample, want: FeedFormatAtom},
+		{name: "iso-8859-1", dat: latin1Sample, want: FeedFormatRSS},
+		{name: "uppercase root", dat: `<RSS><channel/></RSS>`, want: FeedFormatRSS},
+		{name: "html page", dat: `<!DOCTYPE html><html><head></head></html>`, wantErr: true},
+		{name: "empty", dat: ``, wantErr: true},
+		{name: "not xml", dat: `{"title": "json"}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := detectFeedFormat([]byte(tt.dat))
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("detectFeedFormat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("detectFeedFormat() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFeed(t *testing.T) {
+	tests := []struct {
+		name string
+		dat  string
+		want ParsedFeed
+	}{
+		{
+			name: "rss",
+			dat:  rssSample,
+			want: ParsedFeed{
+				Format:      FeedFormatRSS,
+				Title:       "Example Blog",
+				Link:        "https://example.com/",
+				Description: "Posts about things",
+				Updated:     "Mon, 02 Jan 2006 15:04:05 +0000",
+				TTL:         time.Hour,
+				Items: []FeedItem{{
+					ID:          "https://example.com/first",
+					Title:       "First post",
+					Link:        "https://example.com/first",
+					Description: "Summary",
+					Content:     "<p>Full text</p>",
+					PubDate:     "Mon, 02 Jan 2006 15:04:05 +0000",
+					Author:      "Jane Doe",
+					Categories:  []string{"go", "rss"},
+					Enclosure: &FeedEnclosure{
+						URL:    "https://example.com/first.mp3",
+						Type:   "audio/mpeg",
+						Length: 1234,
+					},
+				}},
+			},
+		},
+		{
+			name: "rdf",
+			dat:  rdfSample,
+			want: ParsedFeed{
+				Format:      FeedFormatRDF,
+				Title:       "Example RDF",
+				Link:        "https://example.org/",
+				Description: "An RSS 1.0 feed",
+				Updated:     "2006-01-02T15:04:05Z",
+				TTL:         12 * time.Hour,
+				Items: []FeedItem{{
+					ID:          "https://example.org/item",
+					Title:       "An item",
+					Link:        "https://example.org/item",
+					Description: "Item summary",
+					PubDate:     "2006-01-02T15:04:05Z",
+					Author:      "John",
+					Categories:  []string{"news"},
+				}},
+			},
+		},
+		{
+			name: "atom",
+			dat:  atomSample,
+			want: ParsedFeed{
+				Format:      FeedFormatAtom,
+				Title:       "Example Atom",
+				Link:        "https://example.net/",
+				Description: "All the news",
+				Updated:     "2006-01-02T15:04:05Z",
+				Items: []FeedItem{{
+					ID:          "urn:uuid:1225c695-cfb8-4ebb-aaaa-80da344efa6a",
+					Title:       "Entry",
+					Link:        "https://example.net/entry",
+					Description: "Short",
+					Content:     `<div xmlns="http://www.w3.org/1999/xhtml"><p>Long</p></div>`,
+					PubDate:     "2006-01-03T15:04:05Z",
+					Author:      "Ann, Bob",
+					Categories:  []string{"Technology", "misc"},
+					Enclosure: &FeedEnclosure{
+						URL:    "https://example.net/entry.mp3",
+						Type:   "audio/mpeg",
+						Length: 42,
+					},
+				}},
+			},
+		},
+		{
+			name: "iso-8859-1",
+			dat:  latin1Sample,
+			want: ParsedFeed{
+				Format: FeedFormatRSS,
+				Title:  "Café",
+				Items:  []FeedItem{},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseFeed([]byte(tt.dat))
+			if err != nil {
+				t.Fatalf("parseFeed() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseFeed() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
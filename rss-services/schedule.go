@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hoang-cao-long/golang-side-projects/rss-services/internal/database"
+)
+
+const (
+	minFetchInterval     = 15 * time.Minute
+	maxFetchInterval     = 24 * time.Hour
+	defaultFetchInterval = time.Hour
+
+	// Number of recent posts used to estimate how often a feed publishes
+	postFrequencySample = 20
+)
+
+// nextFetchInterval decides how long to wait before fetching a feed again.
+// It polls at twice the observed publishing rate, but never more often
+// than the publisher's TTL or the HTTP cache lifetime allow.
+func nextFetchInterval(postDates []time.Time, ttl, cacheMaxAge time.Duration) time.Duration {
+	interval := defaultFetchInterval
+
+	if observed, ok := averagePostInterval(postDates); ok {
+		interval = observed / 2
+	}
+
+	interval = max(interval, ttl, cacheMaxAge)
+
+	return min(max(interval, minFetchInterval), maxFetchInterval)
+}
+
+// averagePostInterval expects dates sorted newest first
+func averagePostInterval(postDates []time.Time) (time.Duration, bool) {
+	if len(postDates) < 2 {
+		return 0, false
+	}
+
+	newest := postDates[0]
+	oldest := postDates[len(postDates)-1]
+
+	span := newest.Sub(oldest)
+	if span <= 0 {
+		return 0, false
+	}
+
+	return span / time.Duration(len(postDates)-1), true
+}
+
+func scheduleNextFetch(ctx context.Context, db *database.Queries, feedID uuid.UUID, ttl, cacheMaxAge time.Duration) {
+	postDates, err := db.GetRecentPostDatesForFeed(ctx, database.GetRecentPostDatesForFeedParams{
+		FeedID: feedID,
+		Limit:  postFrequencySample,
+	})
+
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting recent posts of feed", "error", err)
+	}
+
+	interval := nextFetchInterval(postDates, ttl, cacheMaxAge)
+
+	err = db.ScheduleFeedFetch(ctx, database.ScheduleFeedFetchParams{
+		IntervalSeconds: int32(interval / time.Second),
+		ID:              feedID,
+	})
+
+	if err != nil {
+		slog.ErrorContext(ctx, "Error scheduling next fetch of feed", "error", err)
+		return
+	}
+
+	slog.DebugContext(ctx, "Next fetch of feed scheduled", "interval", interval.String())
+}
@@ -3,89 +3,301 @@ package main
 import (
 	"context"
 	"database/sql"
-	"log"
-	"strings"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/hoang-cao-long/golang-side-projects/rss-services/internal/database"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// How long a replica owns a claimed feed. Longer than a fetch plus
+// storing its posts, so a lease only expires if the replica died.
+const feedClaimLease = 5 * time.Minute
+
 func startScraping(
+	ctx context.Context,
 	db *database.Queries,
+	status *scraperStatus,
 	concurrency int,
 	timeBetweenRequest time.Duration,
 ) {
-	log.Printf("Scraping on %v goroutines every %s duration", concurrency, timeBetweenRequest)
+	replicaID := scraperReplicaID()
+
+	slog.InfoContext(ctx, "Scraper started",
+		"replica_id", replicaID,
+		"concurrency", concurrency,
+		"interval", timeBetweenRequest.String(),
+	)
 	ticker := time.NewTicker(timeBetweenRequest)
-	for ; ; <-ticker.C {
-		feeds, err := db.GetNextFeedToFetch(context.Background(), int32(concurrency))
+	defer ticker.Stop()
 
-		if err != nil {
-			log.Println("error fetching feed", err)
-			continue
+	for {
+		updateScraperQueueLag(ctx, db)
+
+		feeds, err := db.ClaimFeedsToFetch(ctx, database.ClaimFeedsToFetchParams{
+			ClaimedBy:    sql.NullString{String: replicaID, Valid: true},
+			LeaseSeconds: int32(feedClaimLease / time.Second),
+			MaxFeeds:     int32(concurrency),
+		})
+
+		if err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "Error claiming feeds", "error", err)
 		}
 
 		wg := &sync.WaitGroup{}
 		for _, feed := range feeds {
 			wg.Add(1)
-			go scrapeFeed(db, wg, feed)
+			go scrapeFeed(ctx, db, wg, replicaID, feed)
 		}
 		wg.Wait()
+
+		if err == nil {
+			status.recordSuccess()
+		}
+
+		select {
+		case <-ctx.Done():
+			slog.Info("Scraper stopped")
+			return
+		case <-ticker.C:
+		}
 	}
 }
 
-func scrapeFeed(db *database.Queries, wg *sync.WaitGroup, feed database.Feed) {
+// Outcomes of a scrape, logged once per feed
+const (
+	scrapeOutcomeCollected   = "collected"
+	scrapeOutcomeNotModified = "not_modified"
+	scrapeOutcomeFailed      = "failed"
+	scrapeOutcomeCancelled   = "cancelled"
+)
+
+// scrapeFeed fetches a feed and stores its posts. Cancelling ctx aborts
+// the fetch, but once the body is in, the posts of the feed are still
+// written so a shutdown never leaves a feed half-stored.
+func scrapeFeed(ctx context.Context, db *database.Queries, wg *sync.WaitGroup, replicaID string, feed database.Feed) {
 	defer wg.Done()
 
-	_, err := db.MarkFeedAsFetched(context.Background(), feed.ID)
+	ctx = withLogAttrs(ctx,
+		slog.String("feed_id", feed.ID.String()),
+		slog.String("feed_url", feed.Url),
+	)
 
-	if err != nil {
-		log.Println("Error marking feed as fetched:", err)
+	// Groups the fetch and the queries of one scrape in a trace
+	ctx, span := tracer.Start(ctx, "scrapeFeed", trace.WithAttributes(
+		attribute.String("feed.id", feed.ID.String()),
+		semconv.URLFull(feed.Url),
+	))
+	defer span.End()
+
+	dbCtx := context.WithoutCancel(ctx)
+
+	start := time.Now()
+	outcome := scrapeOutcomeCollected
+	var summary []slog.Attr
+
+	// Logged last, after the claim is released
+	defer func() {
+		level := slog.LevelInfo
+		if outcome == scrapeOutcomeFailed {
+			level = slog.LevelWarn
+		}
+
+		attrs := append([]slog.Attr{
+			slog.String("outcome", outcome),
+			slog.Int64("duration_ms", time.Since(start).Milliseconds()),
+		}, summary...)
+
+		span.SetAttributes(attribute.String("feed.scrape_outcome", outcome))
+		slog.LogAttrs(dbCtx, level, "Feed scraped", attrs...)
+	}()
+
+	defer func() {
+		err := db.ReleaseFeedClaim(dbCtx, database.ReleaseFeedClaimParams{
+			ID:        feed.ID,
+			ClaimedBy: sql.NullString{String: replicaID, Valid: true},
+		})
+
+		if err != nil {
+			slog.ErrorContext(dbCtx, "Error releasing feed claim", "error", err)
+		}
+	}()
+
+	fetchedAt := time.Now().UTC()
+	fetch, err := urlToFeed(ctx, feed.Url, feed.Etag.String, feed.LastModified.String)
+
+	if err != nil && ctx.Err() != nil {
+		outcome = scrapeOutcomeCancelled
 		return
 	}
 
-	rssFeed, err := urlToFeed(feed.Url)
+	observeFeedFetch(fetch, err, time.Since(fetchedAt))
 
 	if err != nil {
-		log.Println("Error fetching feed:", err)
+		outcome = scrapeOutcomeFailed
+		summary = append(summary, slog.Int("status_code", fetch.StatusCode), slog.String("error", err.Error()))
+		recordFeedFailure(dbCtx, db, feed, err)
 		return
 	}
 
-	for _, item := range rssFeed.Channel.Item {
-		description := sql.NullString{}
+	// The TTL is only known once the body has been parsed
+	var ttl time.Duration
+	defer func() {
+		scheduleNextFetch(dbCtx, db, feed.ID, ttl, fetch.MaxAge)
+	}()
 
-		if item.Description != "" {
-			description.String = item.Description
-			description.Valid = true
-		}
+	if fetch.NotModified {
+		outcome = scrapeOutcomeNotModified
+		saveFeedCacheValidators(dbCtx, db, feed, fetch)
+		recordFeedSuccess(dbCtx, db, feed)
+		return
+	}
 
-		pubAt, err := time.Parse(time.RFC1123Z, item.PubDate)
+	parsedFeed := fetch.Feed
+	ttl = parsedFeed.TTL
 
-		if err != nil {
-			log.Printf("Could not parse date %v with err %v", item.PubDate, err)
+	counts := postCounts{}
+
+	for _, item := range parsedFeed.Items {
+		itemKey := item.ID
+		if itemKey == "" {
+			itemKey = item.Link
+		}
+
+		if itemKey == "" {
+			slog.WarnContext(dbCtx, "Skipping item without guid or link", "title", item.Title)
+			counts.Skipped++
 			continue
 		}
 
-		_, err = db.CreatePost(context.Background(), database.CreatePostParams{
-			ID:          uuid.New(),
-			CreatedAt:   time.Now().UTC(),
-			UpdatedAt:   time.Now().UTC(),
-			Title:       item.Title,
-			Description: description,
-			PublishedAt: pubAt,
-			Url:         item.Link,
-			FeedID:      feed.ID,
+		pubAt, pubAtSource := resolvePubDate(item.PubDate, parsedFeed.Updated, fetchedAt)
+
+		if pubAtSource != pubDateSourceItem {
+			slog.DebugContext(dbCtx, "Could not parse item date", "pub_date", item.PubDate, "link", item.Link, "fallback", pubAtSource)
+		}
+
+		params := database.UpsertPostParams{
+			ID:                uuid.New(),
+			CreatedAt:         time.Now().UTC(),
+			UpdatedAt:         time.Now().UTC(),
+			Title:             item.Title,
+			Description:       stringToNullString(item.Description),
+			PublishedAt:       pubAt,
+			Url:               item.Link,
+			FeedID:            feed.ID,
+			PublishedAtSource: pubAtSource,
+			ItemKey:           itemKey,
+			Guid:              stringToNullString(item.ID),
+			Author:            stringToNullString(item.Author),
+			Categories:        item.Categories,
+			Content:           stringToNullString(item.Content),
+		}
+
+		if item.Enclosure != nil {
+			params.EnclosureUrl = stringToNullString(item.Enclosure.URL)
+			params.EnclosureType = stringToNullString(item.Enclosure.Type)
+			params.EnclosureLength = sql.NullInt64{Int64: item.Enclosure.Length, Valid: item.Enclosure.Length > 0}
+		}
+
+		post, err := upsertFeedItem(dbCtx, db, params)
+
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			counts.Unchanged++
+		case err != nil:
+			slog.ErrorContext(dbCtx, "Error upserting post", "link", item.Link, "error", err)
+			counts.Failed++
+		case post.Inserted:
+			counts.New++
+		default:
+			counts.Updated++
+		}
+	}
+
+	// Saving the validators before every item is stored would turn the next
+	// fetch into a 304, and the failed items would never be retried
+	if counts.Failed == 0 {
+		saveFeedCacheValidators(dbCtx, db, feed, fetch)
+		recordFeedSuccess(dbCtx, db, feed)
+	}
+
+	feedID := feed.ID.String()
+	postsUpsertedTotal.WithLabelValues(feedID, "new").Add(float64(counts.New))
+	postsUpsertedTotal.WithLabelValues(feedID, "updated").Add(float64(counts.Updated))
+	postsUpsertedTotal.WithLabelValues(feedID, "unchanged").Add(float64(counts.Unchanged))
+	postsUpsertedTotal.WithLabelValues(feedID, "failed").Add(float64(counts.Failed))
+	postsUpsertedTotal.WithLabelValues(feedID, "skipped").Add(float64(counts.Skipped))
+
+	summary = append(summary,
+		slog.String("format", string(parsedFeed.Format)),
+		slog.Int("posts_found", len(parsedFeed.Items)),
+		slog.Int("posts_new", counts.New),
+		slog.Int("posts_updated", counts.Updated),
+		slog.Int("posts_unchanged", counts.Unchanged),
+		slog.Int("posts_failed", counts.Failed),
+		slog.Int("posts_skipped", counts.Skipped),
+	)
+}
+
+// saveFeedCacheValidators stores the ETag and Last-Modified of a fetch, to
+// be sent back on the next one
+func saveFeedCacheValidators(ctx context.Context, db *database.Queries, feed database.Feed, fetch feedFetch) {
+	if fetch.ETag == feed.Etag.String && fetch.LastModified == feed.LastModified.String {
+		return
+	}
+
+	err := db.UpdateFeedCacheValidators(ctx, database.UpdateFeedCacheValidatorsParams{
+		ID:           feed.ID,
+		Etag:         sql.NullString{String: fetch.ETag, Valid: fetch.ETag != ""},
+		LastModified: sql.NullString{String: fetch.LastModified, Valid: fetch.LastModified != ""},
+	})
+
+	if err != nil {
+		slog.ErrorContext(ctx, "Error saving feed cache validators", "error", err)
+	}
+}
+
+// upsertFeedItem stores one item of a feed. Posts saved before item keys
+// existed are keyed on their link, so an item with a GUID first takes over
+// that row instead of being inserted next to it.
+func upsertFeedItem(ctx context.Context, db *database.Queries, params database.UpsertPostParams) (database.UpsertPostRow, error) {
+	if params.Guid.Valid && params.ItemKey != params.Url {
+		_, err := db.RekeyLegacyPost(ctx, database.RekeyLegacyPostParams{
+			ItemKey: params.ItemKey,
+			FeedID:  params.FeedID,
+			Url:     params.Url,
 		})
 
 		if err != nil {
-			if strings.Contains(err.Error(), "duplicate key") {
-				continue
-			}
-			log.Println("failed to create post:", err)
+			return database.UpsertPostRow{}, fmt.Errorf("rekeying legacy post: %w", err)
 		}
 	}
 
-	log.Printf("Feed %s collected, %v posts found", feed.Name, len(rssFeed.Channel.Item))
+	return db.UpsertPost(ctx, params)
+}
+
+// postCounts tallies what happened to the items of one scrape
+type postCounts struct {
+	New       int
+	Updated   int
+	Unchanged int
+	Failed    int
+	Skipped   int
+}
+
+// scraperReplicaID identifies this process in feed claims
+func scraperReplicaID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
 }
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// scraperStatus lets the readiness check see whether the scraper loop is
+// still running
+type scraperStatus struct {
+	interval time.Duration
+	// Unix nanoseconds of the last loop that claimed feeds without error
+	lastSuccess atomic.Int64
+}
+
+// newScraperStatus counts the start as a success, giving the first loop
+// the same time to finish as any other
+func newScraperStatus(interval time.Duration) *scraperStatus {
+	status := &scraperStatus{interval: interval}
+	status.recordSuccess()
+	return status
+}
+
+func (s *scraperStatus) recordSuccess() {
+	s.lastSuccess.Store(time.Now().UnixNano())
+}
+
+func (s *scraperStatus) LastSuccess() time.Time {
+	return time.Unix(0, s.lastSuccess.Load()).UTC()
+}
+
+// StaleAfter is how long without a successful loop before the scraper is
+// considered dead. Loops wait for their slowest feed, so a few missed
+// intervals are tolerated.
+func (s *scraperStatus) StaleAfter() time.Duration {
+	return max(5*s.interval, feedClaimLease)
+}
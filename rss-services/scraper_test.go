@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hoang-cao-long/golang-side-projects/rss-services/internal/database"
+)
+
+// openTestDB connects to TEST_DATABASE_URL, a database with the migrations
+// in sql/schema applied, and skips the test when it isn't set. Everything
+// runs in a transaction that is rolled back at the end of the test.
+func openTestDB(t *testing.T) (*sql.Tx, *database.Queries) {
+	t.Helper()
+
+	dbURL := os.Getenv("TEST_DATABASE_URL")
+	if dbURL == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	conn, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		t.Fatalf("sql.Open() error = %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	tx, err := conn.BeginTx(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("BeginTx() error = %v", err)
+	}
+	t.Cleanup(func() { tx.Rollback() })
+
+	return tx, newQueries(tx)
+}
+
+func TestUpsertFeedItemRekeysLegacyPost(t *testing.T) {
+	tx, db := openTestDB(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	user, err := db.CreateUser(ctx, database.CreateUserParams{
+		ID:        uuid.New(),
+		CreatedAt: now,
+		UpdatedAt: now,
+		Name:      "rekey",
+	})
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+
+	feed, err := db.CreateFeed(ctx, database.CreateFeedParams{
+		ID:        uuid.New(),
+		CreatedAt: now,
+		UpdatedAt: now,
+		Name:      "rekey",
+		Url:       "https://example.com/" + uuid.NewString() + "/feed",
+		UserID:    user.ID,
+	})
+	if err != nil {
+		t.Fatalf("CreateFeed() error = %v", err)
+	}
+
+	// A post as migration 012 left it, keyed on its link and without a GUID
+	legacyID := uuid.New()
+	link := "https://example.com/first"
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO posts (id, created_at, updated_at, title, published_at, url, feed_id, item_key)
+		VALUES ($1, $2, $2, 'First post', $2, $3, $4, $3)`,
+		legacyID, now, link, feed.ID,
+	)
+	if err != nil {
+		t.Fatalf("inserting legacy post: %v", err)
+	}
+
+	guid := "urn:uuid:" + uuid.NewString()
+
+	_, err = upsertFeedItem(ctx, db, database.UpsertPostParams{
+		ID:                uuid.New(),
+		CreatedAt:         now,
+		UpdatedAt:         now,
+		Title:             "First post",
+		PublishedAt:       now,
+		Url:               link,
+		FeedID:            feed.ID,
+		PublishedAtSource: pubDateSourceItem,
+		ItemKey:           guid,
+		Guid:              stringToNullString(guid),
+		Categories:        []string{},
+	})
+	if err != nil {
+		t.Fatalf("upsertFeedItem() error = %v", err)
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT id, item_key FROM posts WHERE feed_id = $1`, feed.ID)
+	if err != nil {
+		t.Fatalf("listing posts: %v", err)
+	}
+	defer rows.Close()
+
+	var count int
+	for rows.Next() {
+		var id uuid.UUID
+		var itemKey string
+
+		if err := rows.Scan(&id, &itemKey); err != nil {
+			t.Fatalf("scanning post: %v", err)
+		}
+
+		count++
+		if id != legacyID || itemKey != guid {
+			t.Errorf("post = (%s, %q), want (%s, %q)", id, itemKey, legacyID, guid)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("listing posts: %v", err)
+	}
+
+	if count != 1 {
+		t.Errorf("feed has %d posts, want 1", count)
+	}
+}
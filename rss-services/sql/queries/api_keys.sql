@@ -0,0 +1,26 @@
+-- name: CreateAPIKey :one
+INSERT INTO api_keys
+    (id, created_at, user_id, name, prefix, key_hash, expires_at)
+values($1, $2, $3, $4, $5, $6, $7)
+RETURNING *;
+
+-- name: GetAPIKeysForUser :many
+SELECT * FROM api_keys WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: GetAPIKeyByHash :one
+SELECT sqlc.embed(api_keys), sqlc.embed(users) FROM api_keys
+JOIN users ON users.id = api_keys.user_id
+WHERE api_keys.key_hash = $1;
+
+-- name: TouchAPIKey :exec
+-- Only writes once a minute so busy keys don't update on every request
+UPDATE api_keys SET last_used_at = NOW()
+WHERE id = $1
+    AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute');
+
+-- name: DeleteAPIKey :execrows
+DELETE FROM api_keys WHERE id = $1 AND user_id = $2;
+
+-- name: APIKeyExists :one
+SELECT EXISTS (SELECT 1 FROM api_keys WHERE id = $1)::bool;
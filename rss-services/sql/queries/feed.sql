@@ -7,13 +7,75 @@ RETURNING *;
 -- name: GetFeeds :many
 SELECT * FROM feeds;
 
--- name: GetNextFeedToFetch :many
+-- name: GetFeedByURL :one
+SELECT * FROM feeds WHERE url = $1;
+
+-- name: ClaimFeedsToFetch :many
+-- Leases due feeds to one scraper replica. Rows locked by another
+-- replica's claim are skipped, and an expired lease makes the feed
+-- claimable again if that replica died mid-scrape.
+UPDATE feeds
+SET claimed_by = sqlc.arg(claimed_by),
+    claimed_until = NOW() + sqlc.arg(lease_seconds)::int * INTERVAL '1 second',
+    last_fetched_at = NOW(),
+    updated_at = NOW()
+WHERE id IN (
+    SELECT id FROM feeds
+    WHERE active
+        AND (next_fetch_at IS NULL OR next_fetch_at <= NOW())
+        AND (claimed_until IS NULL OR claimed_until < NOW())
+    ORDER BY next_fetch_at ASC NULLS FIRST, last_fetched_at ASC NULLS FIRST
+    LIMIT sqlc.arg(max_feeds)
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: ReleaseFeedClaim :exec
+UPDATE feeds
+SET claimed_by = NULL, claimed_until = NULL
+WHERE id = $1 AND claimed_by = $2;
+
+-- name: UpdateFeedCacheValidators :exec
+UPDATE feeds
+SET etag = $2, last_modified = $3, updated_at = NOW()
+WHERE id = $1;
+
+-- name: ScheduleFeedFetch :exec
+UPDATE feeds
+SET next_fetch_at = NOW() + sqlc.arg(interval_seconds)::int * INTERVAL '1 second'
+WHERE id = sqlc.arg(id);
+
+-- name: RecordFeedSuccess :exec
+UPDATE feeds
+SET consecutive_failures = 0, last_error = NULL, last_success_at = NOW(), updated_at = NOW()
+WHERE id = $1;
+
+-- name: RecordFeedFailure :one
+UPDATE feeds
+SET consecutive_failures = consecutive_failures + 1,
+    last_error = sqlc.arg(last_error),
+    active = consecutive_failures + 1 < sqlc.arg(max_failures)::int,
+    updated_at = NOW()
+WHERE id = sqlc.arg(id)
+RETURNING *;
+
+-- name: GetUnhealthyFeedsForUser :many
 SELECT * FROM feeds
-ORDER BY last_fetched_at ASC NULLS FIRST
-LIMIT $1;
+WHERE user_id = $1 AND (NOT active OR consecutive_failures > 0)
+ORDER BY active ASC, consecutive_failures DESC;
 
--- name: MarkFeedAsFetched :one
+-- name: EnableFeed :one
 UPDATE feeds
-SET last_fetched_at = NOW(), updated_at = NOW()
-WHERE id = $1
+SET active = TRUE, consecutive_failures = 0, last_error = NULL, next_fetch_at = NULL, updated_at = NOW()
+WHERE id = $1 AND user_id = $2
 RETURNING *;
+
+-- name: GetScraperQueueLag :one
+-- How long the longest waiting due feed has been due, 0 when none is.
+-- Feeds without a next fetch are due since they were added or enabled.
+SELECT COALESCE(EXTRACT(EPOCH FROM NOW() - MIN(COALESCE(next_fetch_at, updated_at))), 0)::float8 AS lag_seconds
+FROM feeds
+WHERE active AND (next_fetch_at IS NULL OR next_fetch_at <= NOW());
+
+-- name: FeedExists :one
+SELECT EXISTS (SELECT 1 FROM feeds WHERE id = $1)::bool;
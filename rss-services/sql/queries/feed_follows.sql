@@ -2,10 +2,37 @@
 INSERT INTO feed_follows
     (id, created_at, updated_at, user_id, feed_id)
 values($1, $2, $3, $4, $5)
+ON CONFLICT (user_id, feed_id) DO NOTHING
 RETURNING *;
 
 -- name: GetFeedFollows :many
-SELECT * FROM feed_follows WHERE user_id = $1;
+SELECT * FROM feed_follows
+WHERE user_id = sqlc.arg(user_id)
+    AND (sqlc.narg(folder_id)::uuid IS NULL OR folder_id = sqlc.narg(folder_id));
 
--- name: DeleteFeedFollow :exec
+-- name: GetFeedFollowForFeed :one
+SELECT * FROM feed_follows WHERE user_id = $1 AND feed_id = $2;
+
+-- name: GetFollowedFeeds :many
+SELECT sqlc.embed(feeds), feed_follows.title AS follow_title, folders.name AS folder_name
+FROM feeds
+JOIN feed_follows ON feeds.id = feed_follows.feed_id
+LEFT JOIN folders ON folders.id = feed_follows.folder_id
+WHERE feed_follows.user_id = $1
+ORDER BY folders.position NULLS FIRST, folders.name NULLS FIRST, feeds.name;
+
+-- name: UpdateFeedFollow :one
+-- Only the fields whose set_ flag is true are changed, the others keep
+-- their current value.
+UPDATE feed_follows
+SET folder_id = CASE WHEN sqlc.arg(set_folder_id)::bool THEN sqlc.narg(folder_id)::uuid ELSE folder_id END,
+    title = CASE WHEN sqlc.arg(set_title)::bool THEN sqlc.narg(title)::text ELSE title END,
+    updated_at = sqlc.arg(updated_at)
+WHERE id = sqlc.arg(id) AND user_id = sqlc.arg(user_id)
+RETURNING *;
+
+-- name: DeleteFeedFollow :execrows
 DELETE FROM feed_follows WHERE id = $1 AND user_id = $2;
+
+-- name: FeedFollowExists :one
+SELECT EXISTS (SELECT 1 FROM feed_follows WHERE id = $1)::bool;
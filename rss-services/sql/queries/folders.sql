@@ -0,0 +1,29 @@
+-- name: CreateFolder :one
+INSERT INTO folders
+    (id, created_at, updated_at, user_id, name, position)
+values($1, $2, $3, $4, $5, $6)
+RETURNING *;
+
+-- name: GetFoldersForUser :many
+SELECT * FROM folders WHERE user_id = $1
+ORDER BY position, name;
+
+-- name: GetFolderForUser :one
+SELECT * FROM folders WHERE id = $1 AND user_id = $2;
+
+-- name: UpdateFolder :one
+UPDATE folders
+SET name = $1,
+    position = $2,
+    updated_at = $3
+WHERE id = $4 AND user_id = $5
+RETURNING *;
+
+-- name: DeleteFolder :execrows
+DELETE FROM folders WHERE id = $1 AND user_id = $2;
+
+-- name: GetFolderByName :one
+SELECT * FROM folders WHERE user_id = $1 AND name = $2;
+
+-- name: FolderExists :one
+SELECT EXISTS (SELECT 1 FROM folders WHERE id = $1)::bool;
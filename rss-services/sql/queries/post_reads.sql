@@ -0,0 +1,17 @@
+-- name: MarkPostRead :exec
+INSERT INTO post_reads (user_id, post_id, created_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id, post_id) DO NOTHING;
+
+-- name: MarkPostUnread :exec
+DELETE FROM post_reads WHERE user_id = $1 AND post_id = $2;
+
+-- name: MarkFeedPostsReadBefore :execrows
+INSERT INTO post_reads (user_id, post_id, created_at)
+SELECT feed_follows.user_id, posts.id, sqlc.arg(created_at)
+FROM posts
+JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
+WHERE feed_follows.user_id = sqlc.arg(user_id)
+    AND posts.feed_id = sqlc.arg(feed_id)
+    AND posts.published_at < sqlc.arg(before)
+ON CONFLICT (user_id, post_id) DO NOTHING;
@@ -0,0 +1,7 @@
+-- name: StarPost :exec
+INSERT INTO post_stars (user_id, post_id, created_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id, post_id) DO NOTHING;
+
+-- name: UnstarPost :exec
+DELETE FROM post_stars WHERE user_id = $1 AND post_id = $2;
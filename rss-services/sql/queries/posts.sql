@@ -1,4 +1,6 @@
--- name: CreatePost :one
+-- name: UpsertPost :one
+-- Inserts a new item or updates an existing one whose content changed.
+-- No row is returned when the stored item is unchanged.
 INSERT INTO posts(
     id,
     created_at,
@@ -7,14 +9,138 @@ INSERT INTO posts(
     description,
     published_at,
     url,
-    feed_id)
-values($1, $2, $3, $4, $5, $6, $7, $8
+    feed_id,
+    published_at_source,
+    item_key,
+    guid,
+    author,
+    categories,
+    content,
+    enclosure_url,
+    enclosure_type,
+    enclosure_length)
+values($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17
 )
-RETURNING *;
+ON CONFLICT (feed_id, item_key) DO UPDATE
+SET title = EXCLUDED.title,
+    description = EXCLUDED.description,
+    url = EXCLUDED.url,
+    published_at = CASE
+        WHEN EXCLUDED.published_at_source = 'item' THEN EXCLUDED.published_at
+        ELSE posts.published_at
+    END,
+    published_at_source = CASE
+        WHEN EXCLUDED.published_at_source = 'item' THEN EXCLUDED.published_at_source
+        ELSE posts.published_at_source
+    END,
+    guid = EXCLUDED.guid,
+    author = EXCLUDED.author,
+    categories = EXCLUDED.categories,
+    content = EXCLUDED.content,
+    enclosure_url = EXCLUDED.enclosure_url,
+    enclosure_type = EXCLUDED.enclosure_type,
+    enclosure_length = EXCLUDED.enclosure_length,
+    updated_at = EXCLUDED.updated_at
+WHERE (
+    posts.title, posts.description, posts.url, posts.guid, posts.author, posts.categories,
+    posts.content, posts.enclosure_url, posts.enclosure_type, posts.enclosure_length
+) IS DISTINCT FROM (
+    EXCLUDED.title, EXCLUDED.description, EXCLUDED.url, EXCLUDED.guid, EXCLUDED.author, EXCLUDED.categories,
+    EXCLUDED.content, EXCLUDED.enclosure_url, EXCLUDED.enclosure_type, EXCLUDED.enclosure_length
+) OR (
+    EXCLUDED.published_at_source = 'item'
+    AND (posts.published_at, posts.published_at_source)
+        IS DISTINCT FROM (EXCLUDED.published_at, EXCLUDED.published_at_source)
+)
+RETURNING id, (xmax = 0)::bool AS inserted;
 
 -- name: GetPostsForUser :many
-SELECT posts.* from posts
+-- The post columns are listed rather than embedded to leave search_vector,
+-- which is only used for matching, out of the results.
+SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.description, posts.published_at, posts.url, posts.feed_id, posts.published_at_source, posts.item_key, posts.guid, posts.author, posts.categories, posts.content, posts.enclosure_url, posts.enclosure_type, posts.enclosure_length,
+    EXISTS (
+        SELECT 1 FROM post_reads
+        WHERE post_reads.post_id = posts.id AND post_reads.user_id = feed_follows.user_id
+    )::bool AS read,
+    EXISTS (
+        SELECT 1 FROM post_stars
+        WHERE post_stars.post_id = posts.id AND post_stars.user_id = feed_follows.user_id
+    )::bool AS starred
+FROM posts
+JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
+WHERE feed_follows.user_id = sqlc.arg(user_id)
+    AND (NOT sqlc.arg(unread_only)::bool OR NOT EXISTS (
+        SELECT 1 FROM post_reads
+        WHERE post_reads.post_id = posts.id AND post_reads.user_id = feed_follows.user_id
+    ))
+    AND (NOT sqlc.arg(starred_only)::bool OR EXISTS (
+        SELECT 1 FROM post_stars
+        WHERE post_stars.post_id = posts.id AND post_stars.user_id = feed_follows.user_id
+    ))
+    AND (sqlc.narg(feed_id)::uuid IS NULL OR posts.feed_id = sqlc.narg(feed_id))
+    AND (sqlc.narg(folder_id)::uuid IS NULL OR feed_follows.folder_id = sqlc.narg(folder_id))
+    AND (sqlc.narg(published_since)::timestamp IS NULL OR posts.published_at >= sqlc.narg(published_since))
+    AND (sqlc.narg(published_until)::timestamp IS NULL OR posts.published_at < sqlc.narg(published_until))
+    AND (sqlc.narg(title_pattern)::text IS NULL OR posts.title ILIKE sqlc.narg(title_pattern))
+    AND (sqlc.narg(cursor_published_at)::timestamp IS NULL
+        OR (posts.published_at, posts.id) < (sqlc.narg(cursor_published_at), sqlc.narg(cursor_id)::uuid))
+ORDER BY posts.published_at DESC, posts.id DESC
+LIMIT sqlc.arg(max_posts);
+
+-- name: GetPostForUser :one
+SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.description, posts.published_at, posts.url, posts.feed_id, posts.published_at_source, posts.item_key, posts.guid, posts.author, posts.categories, posts.content, posts.enclosure_url, posts.enclosure_type, posts.enclosure_length,
+    EXISTS (
+        SELECT 1 FROM post_reads
+        WHERE post_reads.post_id = posts.id AND post_reads.user_id = feed_follows.user_id
+    )::bool AS read,
+    EXISTS (
+        SELECT 1 FROM post_stars
+        WHERE post_stars.post_id = posts.id AND post_stars.user_id = feed_follows.user_id
+    )::bool AS starred
+FROM posts
 JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
-WHERE feed_follows.user_id = $1
-ORDER BY posts.published_at DESC
+WHERE posts.id = $1 AND feed_follows.user_id = $2;
+
+-- name: GetRecentPostDatesForFeed :many
+SELECT published_at FROM posts
+WHERE feed_id = $1
+ORDER BY published_at DESC
 LIMIT $2;
+
+-- name: SearchPostsForUser :many
+SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.description, posts.published_at, posts.url, posts.feed_id, posts.published_at_source, posts.item_key, posts.guid, posts.author, posts.categories, posts.content, posts.enclosure_url, posts.enclosure_type, posts.enclosure_length,
+    EXISTS (
+        SELECT 1 FROM post_reads
+        WHERE post_reads.post_id = posts.id AND post_reads.user_id = feed_follows.user_id
+    )::bool AS read,
+    EXISTS (
+        SELECT 1 FROM post_stars
+        WHERE post_stars.post_id = posts.id AND post_stars.user_id = feed_follows.user_id
+    )::bool AS starred,
+    ts_rank(posts.search_vector, query)::real AS rank,
+    ts_headline(
+        'english',
+        coalesce(posts.content, posts.description, posts.title),
+        query,
+        'StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=30, MinWords=10'
+    )::text AS headline
+FROM posts
+JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
+CROSS JOIN websearch_to_tsquery('english', sqlc.arg(query)) query
+WHERE feed_follows.user_id = sqlc.arg(user_id)
+    AND posts.search_vector @@ query
+ORDER BY rank DESC, posts.published_at DESC
+LIMIT sqlc.arg(max_posts);
+
+-- name: RekeyLegacyPost :execrows
+-- Posts stored before item keys existed are keyed on their link. Once
+-- their item is seen with a GUID, the post takes the GUID as its key
+-- rather than being inserted again.
+UPDATE posts SET item_key = sqlc.arg(item_key)
+WHERE feed_id = sqlc.arg(feed_id)
+    AND item_key = sqlc.arg(url)
+    AND guid IS NULL
+    AND NOT EXISTS (
+        SELECT 1 FROM posts existing
+        WHERE existing.feed_id = sqlc.arg(feed_id) AND existing.item_key = sqlc.arg(item_key)
+    );
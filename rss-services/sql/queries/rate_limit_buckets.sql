@@ -0,0 +1,22 @@
+-- name: TakeRateLimitToken :one
+-- Refills the bucket and takes a token in one statement. No row is
+-- returned when the bucket is empty, it is then left untouched.
+INSERT INTO rate_limit_buckets (key, tokens, updated_at)
+VALUES (sqlc.arg(key), sqlc.arg(burst)::float8 - 1, NOW())
+ON CONFLICT (key) DO UPDATE
+SET tokens = LEAST(sqlc.arg(burst)::float8,
+        rate_limit_buckets.tokens + EXTRACT(EPOCH FROM NOW() - rate_limit_buckets.updated_at) * sqlc.arg(rate)::float8) - 1,
+    updated_at = NOW()
+WHERE LEAST(sqlc.arg(burst)::float8,
+        rate_limit_buckets.tokens + EXTRACT(EPOCH FROM NOW() - rate_limit_buckets.updated_at) * sqlc.arg(rate)::float8) >= 1
+RETURNING tokens;
+
+-- name: GetRateLimitTokens :one
+SELECT LEAST(sqlc.arg(burst)::float8,
+    tokens + EXTRACT(EPOCH FROM NOW() - updated_at) * sqlc.arg(rate)::float8)::float8 AS tokens
+FROM rate_limit_buckets
+WHERE key = sqlc.arg(key);
+
+-- name: DeleteStaleRateLimitBuckets :execrows
+DELETE FROM rate_limit_buckets
+WHERE updated_at < NOW() - sqlc.arg(stale_seconds)::int * INTERVAL '1 second';
@@ -1,13 +1,8 @@
 -- name: CreateUser :one
-INSERT INTO users(id, created_at, updated_at, name, api_key)
-values($1, $2, $3, $4,
-    encode(sha256(random()::text::bytea), 'hex')
-)
+INSERT INTO users(id, created_at, updated_at, name)
+values($1, $2, $3, $4)
 RETURNING *;
 
--- name: GetUserByAPIKey :one
-SELECT * FROM users WHERE api_key = $1;
-
 -- -- name: CreateUser :execresult
 
 -- INSERT INTO users
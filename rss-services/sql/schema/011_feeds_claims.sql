@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE feeds ADD COLUMN claimed_by TEXT;
+ALTER TABLE feeds ADD COLUMN claimed_until TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE feeds DROP COLUMN claimed_until;
+ALTER TABLE feeds DROP COLUMN claimed_by;
@@ -0,0 +1,15 @@
+-- +goose Up
+-- item_key identifies an item within its feed: the GUID, or the link
+-- when the feed has none. It replaces the global uniqueness on url.
+ALTER TABLE posts ADD COLUMN item_key TEXT;
+UPDATE posts SET item_key = url;
+ALTER TABLE posts ALTER COLUMN item_key SET NOT NULL;
+ALTER TABLE posts DROP CONSTRAINT posts_url_key;
+CREATE UNIQUE INDEX posts_feed_id_item_key_idx ON posts (feed_id, item_key);
+
+-- +goose Down
+DROP INDEX posts_feed_id_item_key_idx;
+DELETE FROM posts a USING posts b
+WHERE a.url = b.url AND a.created_at > b.created_at;
+ALTER TABLE posts ADD CONSTRAINT posts_url_key UNIQUE (url);
+ALTER TABLE posts DROP COLUMN item_key;
@@ -0,0 +1,17 @@
+-- +goose Up
+ALTER TABLE posts ADD COLUMN guid TEXT;
+ALTER TABLE posts ADD COLUMN author TEXT;
+ALTER TABLE posts ADD COLUMN categories TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE posts ADD COLUMN content TEXT;
+ALTER TABLE posts ADD COLUMN enclosure_url TEXT;
+ALTER TABLE posts ADD COLUMN enclosure_type TEXT;
+ALTER TABLE posts ADD COLUMN enclosure_length BIGINT;
+
+-- +goose Down
+ALTER TABLE posts DROP COLUMN enclosure_length;
+ALTER TABLE posts DROP COLUMN enclosure_type;
+ALTER TABLE posts DROP COLUMN enclosure_url;
+ALTER TABLE posts DROP COLUMN content;
+ALTER TABLE posts DROP COLUMN categories;
+ALTER TABLE posts DROP COLUMN author;
+ALTER TABLE posts DROP COLUMN guid;
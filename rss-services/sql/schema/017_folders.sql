@@ -0,0 +1,26 @@
+-- +goose Up
+CREATE TABLE folders
+(
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    position INT NOT NULL DEFAULT 0,
+    UNIQUE(user_id, name)
+);
+
+ALTER TABLE feed_follows
+    ADD COLUMN folder_id UUID REFERENCES folders(id) ON DELETE SET NULL,
+    ADD COLUMN title TEXT;
+
+CREATE INDEX feed_follows_folder_id_idx ON feed_follows (folder_id);
+
+-- +goose Down
+DROP INDEX feed_follows_folder_id_idx;
+
+ALTER TABLE feed_follows
+    DROP COLUMN title,
+    DROP COLUMN folder_id;
+
+DROP TABLE folders;
@@ -0,0 +1,28 @@
+-- +goose Up
+CREATE TABLE api_keys
+(
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    prefix TEXT NOT NULL,
+    key_hash VARCHAR(64) UNIQUE NOT NULL,
+    last_used_at TIMESTAMP,
+    expires_at TIMESTAMP
+);
+
+CREATE INDEX api_keys_user_id_idx ON api_keys (user_id);
+
+-- Existing keys keep working, only their hash is kept
+INSERT INTO api_keys (id, created_at, user_id, name, prefix, key_hash)
+SELECT gen_random_uuid(), NOW(), id, 'default', left(api_key, 8), encode(sha256(api_key::bytea), 'hex')
+FROM users;
+
+ALTER TABLE users DROP COLUMN api_key;
+
+-- +goose Down
+ALTER TABLE users ADD COLUMN api_key VARCHAR(64) UNIQUE NOT NULL DEFAULT(
+    encode(sha256(random()::text::bytea), 'hex')
+);
+
+DROP TABLE api_keys;
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// Largest JSON request body accepted
+const maxJSONBodySize = 1 << 20
+
+// decodeJSONBody decodes a JSON request body into dst, a pointer to a
+// parameters struct, and validates it against the `validate` tags of the
+// struct. Unknown fields and bodies over maxJSONBodySize are rejected.
+//
+// Supported rules, comma separated:
+//
+//	required  non-blank string, non-nil pointer or non-zero value
+//	min=N     at least N characters for strings, at least N for numbers
+//	max=N     at most N characters for strings, at most N for numbers
+//	url       an http or https URL
+//	uuid      a UUID
+//
+// Rules other than required are skipped for empty values, unless the
+// field is a pointer or an optional that was sent: a blank string sent
+// for a *string field still has to pass them.
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, dst any) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxJSONBodySize)
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(dst); err != nil {
+		return jsonDecodeError(err)
+	}
+
+	if err := decoder.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		return errBadRequest("Request body must contain a single JSON object")
+	}
+
+	if fields := validateStruct(dst); len(fields) > 0 {
+		return errValidation(fields)
+	}
+
+	return nil
+}
+
+func jsonDecodeError(err error) *appError {
+	syntaxErr := &json.SyntaxError{}
+	typeErr := &json.UnmarshalTypeError{}
+	maxBytesErr := &http.MaxBytesError{}
+
+	switch {
+	case errors.Is(err, io.EOF):
+		return errBadRequest("Request body is empty")
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return errBadRequest("Request body contains malformed JSON")
+	case errors.As(err, &syntaxErr):
+		return errBadRequest(fmt.Sprintf("Request body contains malformed JSON at position %d", syntaxErr.Offset))
+	case errors.As(err, &typeErr):
+		return errValidation([]FieldError{{Field: typeErr.Field, Message: typeErrorMessage(typeErr)}})
+	case errors.As(err, &maxBytesErr):
+		return errPayloadTooLarge(fmt.Sprintf("Request body must not be larger than %d bytes", maxBytesErr.Limit))
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return errValidation([]FieldError{{Field: field, Message: "is not a known field"}})
+	default:
+		return errBadRequest(fmt.Sprintf("Error parsing JSON: %v", err))
+	}
+}
+
+// validateStruct checks every field of a struct against its `validate`
+// tag and returns all the failures, named after their JSON keys
+func validateStruct(v any) []FieldError {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	rt := rv.Type()
+
+	fields := []FieldError{}
+
+	for i := range rt.NumField() {
+		field := rt.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		var rules []string
+		if tag := field.Tag.Get("validate"); tag != "" {
+			rules = strings.Split(tag, ",")
+		}
+
+		value := rv.Field(i)
+		_, isOptional := value.Interface().(optionalField)
+
+		if len(rules) == 0 && !isOptional {
+			continue
+		}
+
+		if message := validateField(value, rules); message != "" {
+			fields = append(fields, FieldError{Field: jsonFieldName(field), Message: message})
+		}
+	}
+
+	return fields
+}
+
+// validateField returns the message of the first rule the value breaks
+func validateField(value reflect.Value, rules []string) string {
+	if opt, ok := value.Interface().(optionalField); ok {
+		ptr, err := opt.pointer()
+		if err != nil {
+			return decodeErrorMessage(err)
+		}
+		value = ptr
+	}
+
+	sent := false
+	if value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			if containsRule(rules, "required") {
+				return "is required"
+			}
+			return ""
+		}
+		sent = true
+		value = value.Elem()
+	}
+
+	empty := value.IsZero() || (value.Kind() == reflect.String && strings.TrimSpace(value.String()) == "")
+
+	for _, rule := range rules {
+		name, arg, _ := strings.Cut(rule, "=")
+
+		if name == "required" {
+			if empty {
+				return "is required"
+			}
+			continue
+		}
+
+		if empty && !sent {
+			continue
+		}
+
+		if message := checkRule(value, name, arg); message != "" {
+			return message
+		}
+	}
+
+	return ""
+}
+
+func checkRule(value reflect.Value, name, arg string) string {
+	switch name {
+	case "min", "max":
+		limit, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			panic(fmt.Sprintf("invalid %s rule %q", name, arg))
+		}
+
+		n, unit := int64(0), ""
+		switch value.Kind() {
+		case reflect.String:
+			n, unit = int64(utf8.RuneCountInString(value.String())), " characters"
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n = value.Int()
+		default:
+			panic(fmt.Sprintf("%s rule on unsupported kind %s", name, value.Kind()))
+		}
+
+		if name == "min" && n < limit {
+			return fmt.Sprintf("must be at least %d%s", limit, unit)
+		}
+		if name == "max" && n > limit {
+			return fmt.Sprintf("must be at most %d%s", limit, unit)
+		}
+	case "url":
+		if _, err := normalizeFeedURL(value.String()); err != nil {
+			return "must be a valid http or https URL"
+		}
+	case "uuid":
+		if _, err := uuid.Parse(value.String()); err != nil {
+			return "must be a valid UUID"
+		}
+	default:
+		panic(fmt.Sprintf("unknown validation rule %q", name))
+	}
+
+	return ""
+}
+
+// parseUUIDField parses a UUID from a request body field, failing with a
+// validation error rather than trusting the uuid rule was applied
+func parseUUIDField(field, value string) (uuid.UUID, error) {
+	id, err := uuid.Parse(value)
+	if err != nil {
+		return uuid.UUID{}, errValidation([]FieldError{{Field: field, Message: "must be a valid UUID"}})
+	}
+
+	return id, nil
+}
+
+// optional is a request field that can be left out, for updates where an
+// omitted field is left unchanged. Set reports whether the field was sent,
+// Value is nil when it was left out or sent as null.
+type optional[T any] struct {
+	Set   bool
+	Value *T
+
+	// A value of the wrong type is reported by validateStruct, which
+	// knows the name of the field, unlike the JSON decoder at this point
+	err error
+}
+
+func (o *optional[T]) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	o.err = json.Unmarshal(data, &o.Value)
+	return nil
+}
+
+// optionalField lets validateField validate the value of an optional
+type optionalField interface {
+	pointer() (reflect.Value, error)
+}
+
+func (o optional[T]) pointer() (reflect.Value, error) {
+	return reflect.ValueOf(o.Value), o.err
+}
+
+func typeErrorMessage(err *json.UnmarshalTypeError) string {
+	return fmt.Sprintf("must be a %s", err.Type.String())
+}
+
+func decodeErrorMessage(err error) string {
+	typeErr := &json.UnmarshalTypeError{}
+	if errors.As(err, &typeErr) {
+		return typeErrorMessage(typeErr)
+	}
+	return "is not valid JSON for this field"
+}
+
+func containsRule(rules []string, name string) bool {
+	for _, rule := range rules {
+		if rule == name {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
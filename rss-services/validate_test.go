@@ -0,0 +1,190 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testParams struct {
+	Name     string           `json:"name" validate:"required,max=5"`
+	URL      string           `json:"url" validate:"url"`
+	FolderID *string          `json:"folder_id" validate:"uuid"`
+	Count    int              `json:"count" validate:"min=1,max=10"`
+	Title    optional[string] `json:"title" validate:"max=3"`
+}
+
+func decodeTestBody(body string) (testParams, error) {
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	params := testParams{}
+	err := decodeJSONBody(w, r, &params)
+
+	return params, err
+}
+
+func TestDecodeJSONBody(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantFields []FieldError
+	}{
+		{name: "valid", body: `{"name": "feed", "url": "https://example.com/feed", "count": 3}`},
+		{
+			name:       "optional fields left out",
+			body:       `{"name": "feed"}`,
+			wantStatus: 0,
+		},
+		{
+			name:       "missing required",
+			body:       `{}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantFields: []FieldError{{Field: "name", Message: "is required"}},
+		},
+		{
+			name:       "whitespace is blank",
+			body:       `{"name": "  \t"}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantFields: []FieldError{{Field: "name", Message: "is required"}},
+		},
+		{
+			name:       "max counts characters",
+			body:       `{"name": "éééééé"}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantFields: []FieldError{{Field: "name", Message: "must be at most 5 characters"}},
+		},
+		{name: "max multibyte within limit", body: `{"name": "ééééé"}`},
+		{
+			name:       "number range",
+			body:       `{"name": "feed", "count": 11}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantFields: []FieldError{{Field: "count", Message: "must be at most 10"}},
+		},
+		{
+			name:       "invalid url",
+			body:       `{"name": "feed", "url": "ftp://example.com"}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantFields: []FieldError{{Field: "url", Message: "must be a valid http or https URL"}},
+		},
+		{name: "empty url skips rules", body: `{"name": "feed", "url": ""}`},
+		{name: "valid uuid", body: `{"name": "feed", "folder_id": "0b6e1f5c-2c0d-4a53-9a8e-6c3a3d1e2f40"}`},
+		{name: "null pointer skips rules", body: `{"name": "feed", "folder_id": null}`},
+		{
+			name:       "invalid uuid",
+			body:       `{"name": "feed", "folder_id": "nope"}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantFields: []FieldError{{Field: "folder_id", Message: "must be a valid UUID"}},
+		},
+		{
+			name:       "blank pointer still validated",
+			body:       `{"name": "feed", "folder_id": " "}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantFields: []FieldError{{Field: "folder_id", Message: "must be a valid UUID"}},
+		},
+		{
+			name:       "optional validated when sent",
+			body:       `{"name": "feed", "title": "long"}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantFields: []FieldError{{Field: "title", Message: "must be at most 3 characters"}},
+		},
+		{
+			name:       "optional of the wrong type",
+			body:       `{"name": "feed", "title": 1}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantFields: []FieldError{{Field: "title", Message: "must be a string"}},
+		},
+		{
+			name:       "all failures reported in field order",
+			body:       `{"url": "ftp://example.com", "folder_id": "nope", "count": -1}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantFields: []FieldError{
+				{Field: "name", Message: "is required"},
+				{Field: "url", Message: "must be a valid http or https URL"},
+				{Field: "folder_id", Message: "must be a valid UUID"},
+				{Field: "count", Message: "must be at least 1"},
+			},
+		},
+		{
+			name:       "wrong type",
+			body:       `{"name": 1}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantFields: []FieldError{{Field: "name", Message: "must be a string"}},
+		},
+		{
+			name:       "unknown field",
+			body:       `{"name": "feed", "nmae": "feed"}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantFields: []FieldError{{Field: "nmae", Message: "is not a known field"}},
+		},
+		{name: "trailing value", body: `{"name": "feed"} {"name": "feed"}`, wantStatus: http.StatusBadRequest},
+		{name: "empty body", body: ``, wantStatus: http.StatusBadRequest},
+		{name: "malformed", body: `{"name": `, wantStatus: http.StatusBadRequest},
+		{
+			name:       "too large",
+			body:       `{"name": "` + strings.Repeat("a", maxJSONBodySize) + `"}`,
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeTestBody(tt.body)
+
+			if tt.wantStatus == 0 {
+				if err != nil {
+					t.Fatalf("decodeJSONBody() error = %v, want nil", err)
+				}
+				return
+			}
+
+			appErr := &appError{}
+			if !errors.As(err, &appErr) {
+				t.Fatalf("decodeJSONBody() error = %v, want an appError", err)
+			}
+			if appErr.Status != tt.wantStatus {
+				t.Errorf("decodeJSONBody() status = %d, want %d", appErr.Status, tt.wantStatus)
+			}
+			if !reflect.DeepEqual(appErr.Fields, tt.wantFields) {
+				t.Errorf("decodeJSONBody() fields = %+v, want %+v", appErr.Fields, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestDecodeJSONBodyOptional(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		wantSet   bool
+		wantValue *string
+	}{
+		{name: "left out", body: `{"name": "feed"}`},
+		{name: "null", body: `{"name": "feed", "title": null}`, wantSet: true},
+		{name: "value", body: `{"name": "feed", "title": "abc"}`, wantSet: true, wantValue: ptr("abc")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params, err := decodeTestBody(tt.body)
+			if err != nil {
+				t.Fatalf("decodeJSONBody() error = %v", err)
+			}
+
+			if params.Title.Set != tt.wantSet {
+				t.Errorf("title set = %v, want %v", params.Title.Set, tt.wantSet)
+			}
+			if !reflect.DeepEqual(params.Title.Value, tt.wantValue) {
+				t.Errorf("title value = %v, want %v", params.Title.Value, tt.wantValue)
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}